@@ -0,0 +1,249 @@
+package collector
+
+import (
+	"encoding/json"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+	"math"
+	"os"
+	"sync"
+	"time"
+)
+
+var (
+	channelBaselineDesc      *prometheus.Desc
+	channelAnomalyZScoreDesc *prometheus.Desc
+	channelAnomalyDesc       *prometheus.Desc
+)
+
+func init() {
+	channelBaselineDesc = prometheus.NewDesc(prefix+"channel_baseline", "Rolling baseline (EWMA) of a channel metric", []string{"direction", "frequency_mhz", "metric"}, nil)
+	channelAnomalyZScoreDesc = prometheus.NewDesc(prefix+"channel_anomaly_zscore", "Deviation of the current value from the baseline in standard deviations", []string{"direction", "frequency_mhz", "metric"}, nil)
+	channelAnomalyDesc = prometheus.NewDesc(prefix+"channel_anomaly_bool", "1 if the deviation from the baseline exceeds the anomaly threshold", []string{"direction", "frequency_mhz", "metric"}, nil)
+}
+
+// Metrics the baselines are kept for
+const (
+	AnomalyPower              = "power"
+	AnomalySnr                = "snr"
+	AnomalyUncorrectablesRate = "uncorrectables_rate"
+)
+
+const (
+	DefaultAnomalyHalfLife  = 72 * time.Hour
+	DefaultAnomalyThreshold = 3
+	// baselines don't flag anomalies before they have seen this many samples
+	anomalyWarmupSamples = 30
+	// floor of the standard deviation, so a perfectly stable channel doesn't flag every tenth of a dB
+	anomalyMinStdDev    = 0.1
+	anomalySaveInterval = time.Minute
+	// baselines of channels that weren't seen for this long are dropped, e.g. after the CMTS
+	// moved the bonding group to other frequencies
+	anomalyBaselineExpiry = 7 * 24 * time.Hour
+)
+
+// Baseline is the exponentially weighted moving average and variance of a channel metric
+type Baseline struct {
+	Mean     float64   `json:"mean"`
+	Variance float64   `json:"variance"`
+	Samples  int       `json:"samples"`
+	Updated  time.Time `json:"updated"`
+}
+
+// Anomaly is the deviation of a single sample from its baseline
+type Anomaly struct {
+	Direction    string  `json:"direction"`
+	FrequencyMHz string  `json:"frequency_mhz"`
+	Metric       string  `json:"metric"`
+	Value        float64 `json:"value"`
+	Baseline     float64 `json:"baseline"`
+	ZScore       float64 `json:"zscore"`
+	Anomalous    bool    `json:"anomalous"`
+}
+
+// AnomalyDetector keeps a rolling baseline per channel and metric to catch slow degradation that
+// absolute thresholds miss. Baselines are keyed by frequency, as the gateway reshuffles channel ids
+// after re-ranging, and are persisted to a state file so they survive restarts.
+type AnomalyDetector struct {
+	// HalfLife is the age at which a sample has lost half of its weight in the baseline
+	HalfLife time.Duration
+	// Threshold is the z-score from which a deviation is flagged as anomaly
+	Threshold float64
+
+	path      string
+	mu        sync.Mutex
+	baselines map[string]*Baseline
+	counters  map[string]codewordSample
+	lastSave  time.Time
+}
+
+type codewordSample struct {
+	value float64
+	time  time.Time
+}
+
+// NewAnomalyDetector loads the baselines from path. An empty path keeps them in memory only.
+func NewAnomalyDetector(path string) (*AnomalyDetector, error) {
+	detector := &AnomalyDetector{
+		HalfLife:  DefaultAnomalyHalfLife,
+		Threshold: DefaultAnomalyThreshold,
+		path:      path,
+		baselines: make(map[string]*Baseline),
+		counters:  make(map[string]codewordSample),
+	}
+	if path == "" {
+		return detector, nil
+	}
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return detector, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(content, &detector.baselines); err != nil {
+		return nil, err
+	}
+	return detector, nil
+}
+
+// Observe scores every locked channel of the modem status against its baseline and updates the
+// baselines afterwards
+func (d *AnomalyDetector) Observe(data *ModemStatusData, now time.Time) []*Anomaly {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var anomalies []*Anomaly
+	seen := make(map[string]bool)
+	observe := func(direction, frequency, metric string, value float64) {
+		anomaly := &Anomaly{Direction: direction, FrequencyMHz: normalizeFrequencyLabel(frequency), Metric: metric, Value: value}
+		// two channels of a direction on the same frequency can't share a baseline
+		key := direction + "/" + anomaly.FrequencyMHz + "/" + metric
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+		d.score(anomaly, now)
+		anomalies = append(anomalies, anomaly)
+	}
+	observeUncorrectables := func(direction, frequency, uncorrectables string) {
+		if uncorrectables == "" {
+			return
+		}
+		key := direction + "/" + normalizeFrequencyLabel(frequency)
+		current := codewordSample{parse2float(uncorrectables), now}
+		previous, ok := d.counters[key]
+		d.counters[key] = current
+		// the counters restart from zero when the gateway reboots or the channel relocks
+		if !ok || current.value < previous.value || !current.time.After(previous.time) {
+			return
+		}
+		observe(direction, frequency, AnomalyUncorrectablesRate, (current.value-previous.value)/current.time.Sub(previous.time).Seconds())
+	}
+
+	for _, channel := range data.Downstream {
+		if channel.Locked != "Locked" {
+			continue
+		}
+		observe(DirectionDownstream, channel.CentralFrequency, AnomalyPower, parse2float(channel.Power))
+		observe(DirectionDownstream, channel.CentralFrequency, AnomalySnr, parse2float(channel.Snr))
+		observeUncorrectables(DirectionDownstream, channel.CentralFrequency, channel.Uncorrectables)
+	}
+	for _, channel := range data.OfdmDownstreamData {
+		if channel.LockedOfdm != "Locked" {
+			continue
+		}
+		observe(DirectionOfdmDownstream, channel.CentralFrequencyOfdm, AnomalyPower, parse2float(channel.PowerOfdm))
+		observe(DirectionOfdmDownstream, channel.CentralFrequencyOfdm, AnomalySnr, parse2float(channel.SnrOfdm))
+		observeUncorrectables(DirectionOfdmDownstream, channel.CentralFrequencyOfdm, channel.Uncorrectables)
+	}
+	for _, channel := range data.Upstream {
+		if channel.Locked != "Locked" {
+			continue
+		}
+		observe(DirectionUpstream, channel.CentralFrequency, AnomalyPower, parse2float(channel.Power))
+	}
+	for _, channel := range data.OfdmUpstreamData {
+		if channel.LockedOfdm != "Locked" {
+			continue
+		}
+		observe(DirectionOfdmUpstream, channel.CentralFrequencyOfdm, AnomalyPower, parse2float(channel.PowerOfdm))
+	}
+
+	if now.Sub(d.lastSave) >= anomalySaveInterval {
+		d.prune(now)
+		if d.path != "" {
+			if err := d.save(); err != nil {
+				log.Errorf("error saving anomaly baselines: %s", err.Error())
+			}
+		}
+		d.lastSave = now
+	}
+	return anomalies
+}
+
+// prune drops the baselines and counters of channels that weren't seen for anomalyBaselineExpiry
+func (d *AnomalyDetector) prune(now time.Time) {
+	for key, baseline := range d.baselines {
+		if now.Sub(baseline.Updated) > anomalyBaselineExpiry {
+			delete(d.baselines, key)
+		}
+	}
+	for key, sample := range d.counters {
+		if now.Sub(sample.time) > anomalyBaselineExpiry {
+			delete(d.counters, key)
+		}
+	}
+}
+
+// score computes the z-score of the sample against the baseline and then folds the sample into
+// the baseline. The weight of a sample depends on the time since the previous one, so the
+// baseline doesn't depend on the scrape interval. Until the baseline is warmed up it is a plain
+// average of the samples seen so far.
+func (d *AnomalyDetector) score(anomaly *Anomaly, now time.Time) {
+	key := anomaly.Direction + "/" + anomaly.FrequencyMHz + "/" + anomaly.Metric
+	baseline, ok := d.baselines[key]
+	if !ok {
+		d.baselines[key] = &Baseline{Mean: anomaly.Value, Samples: 1, Updated: now}
+		anomaly.Baseline = anomaly.Value
+		return
+	}
+
+	if baseline.Samples >= anomalyWarmupSamples {
+		anomaly.ZScore = (anomaly.Value - baseline.Mean) / math.Max(math.Sqrt(baseline.Variance), anomalyMinStdDev)
+		anomaly.Anomalous = math.Abs(anomaly.ZScore) >= d.Threshold
+	}
+
+	alpha := 1 - math.Exp(-math.Ln2*now.Sub(baseline.Updated).Seconds()/d.HalfLife.Seconds())
+	if baseline.Samples < anomalyWarmupSamples {
+		alpha = math.Max(alpha, 1/float64(baseline.Samples+1))
+	}
+	alpha = math.Min(math.Max(alpha, 0), 1)
+	diff := anomaly.Value - baseline.Mean
+	increment := alpha * diff
+	baseline.Mean += increment
+	baseline.Variance = (1 - alpha) * (baseline.Variance + diff*increment)
+	baseline.Samples++
+	baseline.Updated = now
+	anomaly.Baseline = baseline.Mean
+}
+
+func (d *AnomalyDetector) save() error {
+	content, err := json.Marshal(d.baselines)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(d.path, content)
+}
+
+func (c *Collector) collectAnomalies(ch chan<- prometheus.Metric, data *ModemStatusData) {
+	if c.Anomalies == nil {
+		return
+	}
+	for _, anomaly := range c.Anomalies.Observe(data, time.Now()) {
+		labels := []string{anomaly.Direction, anomaly.FrequencyMHz, anomaly.Metric}
+		ch <- prometheus.MustNewConstMetric(channelBaselineDesc, prometheus.GaugeValue, anomaly.Baseline, labels...)
+		ch <- prometheus.MustNewConstMetric(channelAnomalyZScoreDesc, prometheus.GaugeValue, anomaly.ZScore, labels...)
+		ch <- prometheus.MustNewConstMetric(channelAnomalyDesc, prometheus.GaugeValue, bool2float64(anomaly.Anomalous), labels...)
+	}
+}
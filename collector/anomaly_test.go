@@ -0,0 +1,77 @@
+package collector_test
+
+import (
+	"github.com/reynico/fibertel-station-exporter/collector"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func findAnomaly(anomalies []*collector.Anomaly, direction, frequencyMHz, metric string) *collector.Anomaly {
+	for _, anomaly := range anomalies {
+		if anomaly.Direction == direction && anomaly.FrequencyMHz == frequencyMHz && anomaly.Metric == metric {
+			return anomaly
+		}
+	}
+	return nil
+}
+
+func TestAnomalyDetector(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "baselines.json")
+	detector, err := collector.NewAnomalyDetector(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 60; i++ {
+		data := newTestModemStatusData()
+		data.Downstream[0].Snr = strconv.FormatFloat(38.4+float64(i%3)*0.2, 'f', 1, 64) + " dB"
+		data.Downstream[0].Uncorrectables = strconv.Itoa(i * 60)
+		anomalies := detector.Observe(data, now)
+		if snr := findAnomaly(anomalies, collector.DirectionDownstream, "603", collector.AnomalySnr); snr == nil || snr.Anomalous {
+			t.Fatalf("expected no anomaly while the SNR is stable, got %+v", snr)
+		}
+		now = now.Add(time.Minute)
+	}
+
+	data := newTestModemStatusData()
+	data.Downstream[0].Snr = "35.0 dB"
+	data.Downstream[0].Uncorrectables = strconv.Itoa(60*60 + 6000)
+	anomalies := detector.Observe(data, now)
+	if snr := findAnomaly(anomalies, collector.DirectionDownstream, "603", collector.AnomalySnr); snr == nil || !snr.Anomalous || snr.ZScore > -3 {
+		t.Errorf("expected the SNR drop to be an anomaly, got %+v", snr)
+	}
+	if rate := findAnomaly(anomalies, collector.DirectionDownstream, "603", collector.AnomalyUncorrectablesRate); rate == nil || !rate.Anomalous || rate.Value != 101 {
+		t.Errorf("expected the burst of uncorrectables to be an anomaly, got %+v", rate)
+	}
+	if power := findAnomaly(anomalies, collector.DirectionDownstream, "603", collector.AnomalyPower); power == nil || power.Anomalous {
+		t.Errorf("expected no power anomaly, got %+v", power)
+	}
+	if unlocked := findAnomaly(anomalies, collector.DirectionDownstream, "621", collector.AnomalyPower); unlocked != nil {
+		t.Errorf("expected unlocked channels to be skipped, got %+v", unlocked)
+	}
+
+	reloaded, err := collector.NewAnomalyDetector(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	anomalies = reloaded.Observe(data, now.Add(time.Minute))
+	if snr := findAnomaly(anomalies, collector.DirectionDownstream, "603", collector.AnomalySnr); snr == nil || !snr.Anomalous {
+		t.Errorf("expected the baseline to be persisted, got %+v", snr)
+	}
+
+	// the channel moves away for more than a week, its old baseline is dropped
+	moved := newTestModemStatusData()
+	moved.Downstream[0].CentralFrequency = "633 MHz"
+	later := now.Add(8 * 24 * time.Hour)
+	reloaded.Observe(moved, later)
+	reloaded, err = collector.NewAnomalyDetector(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	anomalies = reloaded.Observe(data, later.Add(time.Minute))
+	if snr := findAnomaly(anomalies, collector.DirectionDownstream, "603", collector.AnomalySnr); snr == nil || snr.Anomalous || snr.Baseline != 35 {
+		t.Errorf("expected a new baseline for the channel coming back, got %+v", snr)
+	}
+}
@@ -79,6 +79,7 @@ type OfdmDownstreamData struct {
 	FftOfdm              string `json:"FFT"`
 	LockedOfdm           string `json:"LockStatus"`
 	ChannelType          string `json:"ChannelType"`
+	Uncorrectables       string `json:"UncorrectableCodewords"`
 }
 
 type OfdmUpstreamData struct {
@@ -103,6 +104,7 @@ type DocsisDownstreamChannel struct {
 	Modulation       string `json:"Modulation"`
 	Locked           string `json:"LockStatus"`
 	ChannelType      string `json:"ChannelType"`
+	Uncorrectables   string `json:"UncorrectableCodewords"`
 }
 
 type DocsisUpstreamChannel struct {
@@ -112,9 +114,99 @@ type DocsisUpstreamChannel struct {
 	Power            string `json:"PowerLevel"`
 	ChannelType      string `json:"ChannelType"`
 	SymbolRate       string `json:"SymbolRate"`
+	Modulation       string `json:"Modulation"`
 	Locked           string `json:"LockStatus"`
 }
 
+type InterfaceStatsResponse struct {
+	Error   string              `json:"error"`
+	Message string              `json:"message"`
+	Data    *InterfaceStatsData `json:"data"`
+}
+
+type InterfaceStatsData struct {
+	Interfaces []*InterfaceStats `json:"IfStatsTbl"`
+}
+
+type InterfaceStats struct {
+	Id              string `json:"__id"`
+	Name            string `json:"Name"`
+	BytesReceived   string `json:"BytesReceived"`
+	BytesSent       string `json:"BytesSent"`
+	PacketsReceived string `json:"PacketsReceived"`
+	PacketsSent     string `json:"PacketsSent"`
+}
+
+type LanPortStatusResponse struct {
+	Error   string             `json:"error"`
+	Message string             `json:"message"`
+	Data    *LanPortStatusData `json:"data"`
+}
+
+type LanPortStatusData struct {
+	Ports []*LanPortStatus `json:"LanPortTbl"`
+}
+
+type LanPortStatus struct {
+	Id         string `json:"__id"`
+	Port       string `json:"Port"`
+	LinkStatus string `json:"LinkStatus"`
+	Speed      string `json:"Speed"`
+	Duplex     string `json:"Duplex"`
+}
+
+type VoiceStatusResponse struct {
+	Error   string           `json:"error"`
+	Message string           `json:"message"`
+	Data    *VoiceStatusData `json:"data"`
+}
+
+type VoiceStatusData struct {
+	ProvisioningState string       `json:"MtaProvStatus"`
+	Lines             []*VoiceLine `json:"LineTbl"`
+}
+
+type VoiceLine struct {
+	Id                 string `json:"__id"`
+	Line               string `json:"Line"`
+	DirectoryNumber    string `json:"DirectoryNumber"`
+	RegistrationStatus string `json:"RegistrationStatus"`
+	HookStatus         string `json:"HookStatus"`
+}
+
+type EventLogResponse struct {
+	Error   string        `json:"error"`
+	Message string        `json:"message"`
+	Data    *EventLogData `json:"data"`
+}
+
+type EventLogData struct {
+	Entries []*EventLogEntry `json:"EventLogTbl"`
+}
+
+type EventLogEntry struct {
+	Id       string `json:"__id"`
+	Time     string `json:"Time"`
+	Priority string `json:"Priority"`
+	EventId  string `json:"EventID"`
+	Text     string `json:"Text"`
+}
+
+type SystemInfoResponse struct {
+	Error   string          `json:"error"`
+	Message string          `json:"message"`
+	Data    *SystemInfoData `json:"data"`
+}
+
+type SystemInfoData struct {
+	ModelName       string `json:"ModelName"`
+	SoftwareVersion string `json:"SoftwareVersion"`
+	HardwareVersion string `json:"HardwareVersion"`
+	SerialNumber    string `json:"SerialNumber"`
+	MacAddress      string `json:"CMMACAddress"`
+	UpTime          string `json:"UpTime"`
+}
+
 func NewFibertelStation(stationUrl, username, password string) *FibertelStation {
 	cookieJar, err := cookiejar.New(nil)
 	parsedUrl, err := url.Parse(stationUrl)
@@ -204,6 +296,61 @@ func (v *FibertelStation) GetModemStatus() (*ModemStatusResponse, error) {
 	return modemStatusResponse, json.Unmarshal(responseBody, modemStatusResponse)
 }
 
+// GetInterfaceStats returns the traffic counters of the WAN, LAN and WLAN interfaces
+func (v *FibertelStation) GetInterfaceStats() (*InterfaceStatsResponse, error) {
+	responseBody, err := v.doRequest("GET", v.URL+"/api/v1/network/IfStatsTbl?_="+strconv.FormatInt(makeTimestamp(), 10), "")
+	if err != nil {
+		return nil, err
+	}
+	log.Debugf("Interface stats response body: %s\n", responseBody)
+	interfaceStatsResponse := &InterfaceStatsResponse{}
+	return interfaceStatsResponse, json.Unmarshal(responseBody, interfaceStatsResponse)
+}
+
+// GetLanPortStatus returns link status, speed and duplex of the physical LAN ports
+func (v *FibertelStation) GetLanPortStatus() (*LanPortStatusResponse, error) {
+	responseBody, err := v.doRequest("GET", v.URL+"/api/v1/network/LanPortTbl?_="+strconv.FormatInt(makeTimestamp(), 10), "")
+	if err != nil {
+		return nil, err
+	}
+	log.Debugf("LAN port status response body: %s\n", responseBody)
+	lanPortStatusResponse := &LanPortStatusResponse{}
+	return lanPortStatusResponse, json.Unmarshal(responseBody, lanPortStatusResponse)
+}
+
+// GetVoiceStatus returns the provisioning state of the embedded MTA and the status of its voice lines
+func (v *FibertelStation) GetVoiceStatus() (*VoiceStatusResponse, error) {
+	responseBody, err := v.doRequest("GET", v.URL+"/api/v1/voice/MtaProvStatus,LineTbl?_="+strconv.FormatInt(makeTimestamp(), 10), "")
+	if err != nil {
+		return nil, err
+	}
+	log.Debugf("Voice status response body: %s\n", responseBody)
+	voiceStatusResponse := &VoiceStatusResponse{}
+	return voiceStatusResponse, json.Unmarshal(responseBody, voiceStatusResponse)
+}
+
+// GetEventLog returns the DOCSIS event log of the gateway
+func (v *FibertelStation) GetEventLog() (*EventLogResponse, error) {
+	responseBody, err := v.doRequest("GET", v.URL+"/api/v1/modem/EventLogTbl?_="+strconv.FormatInt(makeTimestamp(), 10), "")
+	if err != nil {
+		return nil, err
+	}
+	log.Debugf("Event log response body: %s\n", responseBody)
+	eventLogResponse := &EventLogResponse{}
+	return eventLogResponse, json.Unmarshal(responseBody, eventLogResponse)
+}
+
+// GetSystemInfo returns model, firmware version, serial number and uptime of the gateway
+func (v *FibertelStation) GetSystemInfo() (*SystemInfoResponse, error) {
+	responseBody, err := v.doRequest("GET", v.URL+"/api/v1/system/ModelName,SoftwareVersion,HardwareVersion,SerialNumber,CMMACAddress,UpTime?_="+strconv.FormatInt(makeTimestamp(), 10), "")
+	if err != nil {
+		return nil, err
+	}
+	log.Debugf("System info response body: %s\n", responseBody)
+	systemInfoResponse := &SystemInfoResponse{}
+	return systemInfoResponse, json.Unmarshal(responseBody, systemInfoResponse)
+}
+
 func makeTimestamp() int64 {
 	return time.Now().UnixNano() / int64(time.Millisecond)
 }
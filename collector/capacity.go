@@ -0,0 +1,119 @@
+package collector
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var estimatedCapacityDesc *prometheus.Desc
+
+func init() {
+	estimatedCapacityDesc = prometheus.NewDesc(prefix+"estimated_capacity_bits_per_second", "Theoretical raw PHY capacity of all locked channels", []string{"direction"}, nil)
+}
+
+const (
+	// symbol rates of downstream SC-QAM channels (ITU-T J.83 Annex B)
+	qam64SymbolRate  = 5.056941e6
+	qam256SymbolRate = 5.360537e6
+
+	// OFDM and OFDMA sample rates, the subcarrier spacing is the sample rate divided by the FFT size
+	ofdmSampleRate  = 204.8e6
+	ofdmaSampleRate = 102.4e6
+	// cyclic prefix of 256 samples at 204.8 MHz, a common setting for both directions
+	ofdmCyclicPrefix = 1.25e-6
+
+	// modulations assumed when the gateway doesn't report them. It never does for OFDM/OFDMA
+	// channels, whose profiles can mix modulations, so the highest orders in common use are assumed.
+	defaultUpstreamModulation       = 64
+	defaultOfdmDownstreamModulation = 4096
+	defaultOfdmUpstreamModulation   = 1024
+	defaultOfdmDownstreamFft        = 4096
+	defaultOfdmUpstreamFft          = 2048
+)
+
+// Capacity is the estimated raw PHY throughput in bits per second, before FEC and MAC overhead
+type Capacity struct {
+	Downstream float64 `json:"downstream_bps"`
+	Upstream   float64 `json:"upstream_bps"`
+}
+
+// EstimateCapacity adds up the theoretical capacity of all locked channels. SC-QAM channels carry
+// log2(QAM order) bits per symbol at their symbol rate, OFDM/OFDMA channels carry log2(QAM order)
+// bits on every subcarrier that fits in their bandwidth per OFDM symbol. The OFDM/OFDMA estimate
+// is an upper bound, see defaultOfdmDownstreamModulation.
+func EstimateCapacity(data *ModemStatusData) *Capacity {
+	capacity := &Capacity{}
+	for _, channel := range data.Downstream {
+		if channel.Locked != "Locked" {
+			continue
+		}
+		order := parseQamOrder(channel.Modulation, 256)
+		symbolRate := qam256SymbolRate
+		if order <= 64 {
+			symbolRate = qam64SymbolRate
+		}
+		capacity.Downstream += math.Log2(order) * symbolRate
+	}
+	for _, channel := range data.OfdmDownstreamData {
+		if channel.LockedOfdm != "Locked" {
+			continue
+		}
+		capacity.Downstream += ofdmCapacity(parseFrequencyMHz(channel.Bandwidth)*1e6, ofdmSampleRate/parseFftSize(channel.FftOfdm, defaultOfdmDownstreamFft), defaultOfdmDownstreamModulation)
+	}
+	for _, channel := range data.Upstream {
+		if channel.Locked != "Locked" {
+			continue
+		}
+		capacity.Upstream += math.Log2(parseQamOrder(channel.Modulation, defaultUpstreamModulation)) * parseSymbolRate(channel.SymbolRate)
+	}
+	for _, channel := range data.OfdmUpstreamData {
+		if channel.LockedOfdm != "Locked" {
+			continue
+		}
+		capacity.Upstream += ofdmCapacity(parseFrequencyMHz(channel.Bandwidth)*1e6, ofdmaSampleRate/parseFftSize(channel.FftOfdm, defaultOfdmUpstreamFft), defaultOfdmUpstreamModulation)
+	}
+	return capacity
+}
+
+func ofdmCapacity(bandwidth, subcarrierSpacing, order float64) float64 {
+	subcarriers := math.Floor(bandwidth / subcarrierSpacing)
+	symbolDuration := 1/subcarrierSpacing + ofdmCyclicPrefix
+	return subcarriers * math.Log2(order) / symbolDuration
+}
+
+// parseQamOrder extracts the QAM order from strings like "256QAM", "QAM1024" or "qpsk"
+func parseQamOrder(str string, fallback float64) float64 {
+	lower := strings.ToLower(str)
+	switch {
+	case strings.Contains(lower, "qpsk"):
+		return 4
+	case !strings.Contains(lower, "qam"):
+		return fallback
+	}
+	order, err := strconv.ParseFloat(modulationRegex.FindString(lower), 64)
+	if err != nil || order < 2 {
+		return fallback
+	}
+	return order
+}
+
+// parseFftSize extracts the FFT size from strings like "4K" or "8k"
+func parseFftSize(str string, fallback float64) float64 {
+	lower := strings.ToLower(str)
+	if strings.Contains(lower, "qam") || !strings.Contains(lower, "k") {
+		return fallback
+	}
+	size := parse2float(lower)
+	if size <= 0 {
+		return fallback
+	}
+	return size * 1024
+}
+
+func (c *Collector) collectCapacity(ch chan<- prometheus.Metric, data *ModemStatusData) {
+	capacity := EstimateCapacity(data)
+	ch <- prometheus.MustNewConstMetric(estimatedCapacityDesc, prometheus.GaugeValue, capacity.Downstream, DirectionDownstream)
+	ch <- prometheus.MustNewConstMetric(estimatedCapacityDesc, prometheus.GaugeValue, capacity.Upstream, DirectionUpstream)
+}
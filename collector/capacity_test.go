@@ -0,0 +1,22 @@
+package collector_test
+
+import (
+	"github.com/reynico/fibertel-station-exporter/collector"
+	"math"
+	"testing"
+)
+
+func TestEstimateCapacity(t *testing.T) {
+	capacity := collector.EstimateCapacity(newTestModemStatusData())
+
+	// two 256-QAM and one 64-QAM SC-QAM channel plus 1880 subcarriers of 4096-QAM at 50 kHz
+	scQam := 2*8*5.360537e6 + 6*5.056941e6
+	ofdm := 1880 * 12 / (20e-6 + 1.25e-6)
+	if math.Abs(capacity.Downstream-(scQam+ofdm)) > 1 {
+		t.Errorf("expected a downstream capacity of %v, got %v", scQam+ofdm, capacity.Downstream)
+	}
+	// two 64-QAM channels at 5120 ksym/s
+	if math.Abs(capacity.Upstream-2*6*5.12e6) > 1 {
+		t.Errorf("expected an upstream capacity of %v, got %v", 2*6*5.12e6, capacity.Upstream)
+	}
+}
@@ -0,0 +1,211 @@
+package collector
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	channelChangesDesc    *prometheus.Desc
+	channelLastChangeDesc *prometheus.Desc
+)
+
+func init() {
+	channelChangesDesc = prometheus.NewDesc(prefix+"channel_changes_total", "Number of changes to the channel set", []string{"direction", "kind"}, nil)
+	channelLastChangeDesc = prometheus.NewDesc(prefix+"channel_last_change_timestamp_seconds", "Time of the last change to the channel set", nil, nil)
+}
+
+// Kinds of channel changes
+const (
+	ChangeAdded    = "added"
+	ChangeRemoved  = "removed"
+	ChangeUnlocked = "unlocked"
+	ChangeRelocked = "relocked"
+	ChangeMoved    = "moved"
+)
+
+const (
+	maxChannelChangeHistory = 50
+	// channels closer than this are considered to be on the same frequency
+	frequencyToleranceMHz = 0.5
+)
+
+// ChannelChange is a single change to the channel set
+type ChannelChange struct {
+	Time                 time.Time `json:"time"`
+	Direction            string    `json:"direction"`
+	Kind                 string    `json:"kind"`
+	ChannelId            string    `json:"channel_id"`
+	PreviousFrequencyMHz float64   `json:"previous_frequency_mhz,omitempty"`
+	FrequencyMHz         float64   `json:"frequency_mhz,omitempty"`
+}
+
+// ChannelChangeTracker remembers the channel set between polls and detects channels being added,
+// removed, unlocked, relocked or moved to another frequency. Channels are matched by frequency
+// first, as the gateway reshuffles the channel ids after re-ranging, and by id otherwise.
+type ChannelChangeTracker struct {
+	mu         sync.Mutex
+	previous   map[string][]channelState
+	counts     map[channelChangeKey]float64
+	lastChange time.Time
+	history    []*ChannelChange
+}
+
+type channelState struct {
+	channelId    string
+	frequencyMHz float64
+	locked       bool
+}
+
+type channelChangeKey struct {
+	direction string
+	kind      string
+}
+
+func NewChannelChangeTracker() *ChannelChangeTracker {
+	return &ChannelChangeTracker{
+		counts: make(map[channelChangeKey]float64),
+	}
+}
+
+// channelStates lists the channels of the modem status by direction
+func channelStates(data *ModemStatusData) map[string][]channelState {
+	states := make(map[string][]channelState)
+	for _, channel := range data.Downstream {
+		states[DirectionDownstream] = append(states[DirectionDownstream], channelState{channel.ChannelId, parseFrequencyMHz(channel.CentralFrequency), channel.Locked == "Locked"})
+	}
+	for _, channel := range data.Upstream {
+		states[DirectionUpstream] = append(states[DirectionUpstream], channelState{channel.ChannelIdUp, parseFrequencyMHz(channel.CentralFrequency), channel.Locked == "Locked"})
+	}
+	for _, channel := range data.OfdmDownstreamData {
+		states[DirectionOfdmDownstream] = append(states[DirectionOfdmDownstream], channelState{channel.ChannelIdOfdm, parseFrequencyMHz(channel.CentralFrequencyOfdm), channel.LockedOfdm == "Locked"})
+	}
+	for _, channel := range data.OfdmUpstreamData {
+		states[DirectionOfdmUpstream] = append(states[DirectionOfdmUpstream], channelState{channel.ChannelIdOfdm, parseFrequencyMHz(channel.CentralFrequencyOfdm), channel.LockedOfdm == "Locked"})
+	}
+	return states
+}
+
+// Observe compares the channel set with the previous one and returns the changes
+func (t *ChannelChangeTracker) Observe(data *ModemStatusData, now time.Time) []*ChannelChange {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	current := channelStates(data)
+	if t.previous == nil {
+		t.previous = current
+		return nil
+	}
+
+	var changes []*ChannelChange
+	for _, direction := range []string{DirectionDownstream, DirectionUpstream, DirectionOfdmDownstream, DirectionOfdmUpstream} {
+		changes = append(changes, diffChannels(now, direction, t.previous[direction], current[direction])...)
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Direction != changes[j].Direction {
+			return changes[i].Direction < changes[j].Direction
+		}
+		return changes[i].ChannelId < changes[j].ChannelId
+	})
+
+	t.previous = current
+	for _, change := range changes {
+		t.counts[channelChangeKey{change.Direction, change.Kind}]++
+	}
+	if len(changes) > 0 {
+		t.lastChange = now
+		t.history = append(t.history, changes...)
+		if len(t.history) > maxChannelChangeHistory {
+			t.history = t.history[len(t.history)-maxChannelChangeHistory:]
+		}
+	}
+	return changes
+}
+
+// History returns the latest channel changes, newest first
+func (t *ChannelChangeTracker) History() []*ChannelChange {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	history := make([]*ChannelChange, len(t.history))
+	for i, change := range t.history {
+		history[len(t.history)-1-i] = change
+	}
+	return history
+}
+
+// diffChannels matches the channels of a direction by frequency, a channel keeping its frequency
+// under another id hasn't changed, and the rest by id, which is a channel moving to another
+// frequency. Channels matched neither way were added or removed.
+func diffChannels(now time.Time, direction string, previous, current []channelState) []*ChannelChange {
+	var changes []*ChannelChange
+	matched := make([]bool, len(previous))
+	match := func(same func(previous channelState) bool) (channelState, bool) {
+		for i, state := range previous {
+			if !matched[i] && same(state) {
+				matched[i] = true
+				return state, true
+			}
+		}
+		return channelState{}, false
+	}
+
+	var unmatched []channelState
+	for _, state := range current {
+		before, ok := match(func(previous channelState) bool {
+			return math.Abs(previous.frequencyMHz-state.frequencyMHz) <= frequencyToleranceMHz
+		})
+		if !ok {
+			unmatched = append(unmatched, state)
+			continue
+		}
+		change := &ChannelChange{Time: now, Direction: direction, ChannelId: state.channelId, FrequencyMHz: state.frequencyMHz}
+		switch {
+		case before.locked && !state.locked:
+			change.Kind = ChangeUnlocked
+		case !before.locked && state.locked:
+			change.Kind = ChangeRelocked
+		default:
+			continue
+		}
+		changes = append(changes, change)
+	}
+	for _, state := range unmatched {
+		change := &ChannelChange{Time: now, Direction: direction, ChannelId: state.channelId, FrequencyMHz: state.frequencyMHz, Kind: ChangeAdded}
+		if before, ok := match(func(previous channelState) bool { return previous.channelId == state.channelId }); ok {
+			change.Kind = ChangeMoved
+			change.PreviousFrequencyMHz = before.frequencyMHz
+		}
+		changes = append(changes, change)
+	}
+	for i, state := range previous {
+		if !matched[i] {
+			changes = append(changes, &ChannelChange{Time: now, Direction: direction, Kind: ChangeRemoved, ChannelId: state.channelId, PreviousFrequencyMHz: state.frequencyMHz})
+		}
+	}
+	return changes
+}
+
+func (t *ChannelChangeTracker) collect(ch chan<- prometheus.Metric) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for key, count := range t.counts {
+		ch <- prometheus.MustNewConstMetric(channelChangesDesc, prometheus.CounterValue, count, key.direction, key.kind)
+	}
+	if !t.lastChange.IsZero() {
+		ch <- prometheus.MustNewConstMetric(channelLastChangeDesc, prometheus.GaugeValue, float64(t.lastChange.Unix()))
+	}
+}
+
+func (c *Collector) collectChannelChanges(ch chan<- prometheus.Metric, data *ModemStatusData) []*ChannelChange {
+	if c.Changes == nil {
+		return nil
+	}
+	changes := c.Changes.Observe(data, time.Now())
+	c.Changes.collect(ch)
+	return changes
+}
@@ -0,0 +1,61 @@
+package collector_test
+
+import (
+	"github.com/reynico/fibertel-station-exporter/collector"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestChannelChangeTracker(t *testing.T) {
+	tracker := collector.NewChannelChangeTracker()
+	data := newTestModemStatusData()
+	if changes := tracker.Observe(data, time.Now()); len(changes) != 0 {
+		t.Errorf("expected no changes on the first poll, got %+v", changes)
+	}
+
+	data = newTestModemStatusData()
+	data.Downstream[0].CentralFrequency = "651 MHz" // channel 1 moved
+	data.Downstream[3].Locked = "Locked"            // channel 4 relocked
+	data.Upstream = data.Upstream[:1]               // upstream channel 2 removed
+	data.Downstream = append(data.Downstream, &collector.DocsisDownstreamChannel{ChannelId: "5", CentralFrequency: "627 MHz", Locked: "Locked"})
+	changes := tracker.Observe(data, time.Now())
+
+	kinds := make(map[string]string)
+	for _, change := range changes {
+		kinds[change.Direction+"/"+change.ChannelId] = change.Kind
+	}
+	expected := map[string]string{
+		"downstream/1": collector.ChangeMoved,
+		"downstream/4": collector.ChangeRelocked,
+		"downstream/5": collector.ChangeAdded,
+		"upstream/2":   collector.ChangeRemoved,
+	}
+	if len(kinds) != len(expected) {
+		t.Errorf("expected %d changes, got %+v", len(expected), kinds)
+	}
+	for key, kind := range expected {
+		if kinds[key] != kind {
+			t.Errorf("expected %s to be %s, got %q", key, kind, kinds[key])
+		}
+	}
+	if history := tracker.History(); len(history) != 4 {
+		t.Errorf("expected 4 changes in the history, got %d", len(history))
+	}
+}
+
+func TestChannelChangeTrackerRenumbered(t *testing.T) {
+	tracker := collector.NewChannelChangeTracker()
+	tracker.Observe(newTestModemStatusData(), time.Now())
+
+	// after re-ranging the gateway numbers the same downstream channels the other way round
+	data := newTestModemStatusData()
+	for i, channel := range data.Downstream {
+		channel.ChannelId = strconv.Itoa(len(data.Downstream) - i)
+	}
+	data.Downstream[1].Locked = "Not Locked"
+	changes := tracker.Observe(data, time.Now())
+	if len(changes) != 1 || changes[0].Kind != collector.ChangeUnlocked || changes[0].ChannelId != "3" || changes[0].FrequencyMHz != 609 {
+		t.Errorf("expected only the channel on 609 MHz to unlock, got %+v", changes)
+	}
+}
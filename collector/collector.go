@@ -3,20 +3,59 @@ package collector
 import (
 	"fmt"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
 	"regexp"
 	"strconv"
+	"sync"
+	"time"
 )
 
 type Collector struct {
-	Station *FibertelStation
+	Station  *FibertelStation
+	EventLog *EventLog
+	Changes  *ChannelChangeTracker
+	Outages  *OutageTracker
+	// Notifiers are told about line state transitions, e.g. channels unlocking
+	Notifiers []Notifier
+	// History stores every polled modem status, nil disables the history
+	History *HistoryStore
+	// Anomalies keeps rolling baselines per channel, nil disables the anomaly detection
+	Anomalies *AnomalyDetector
+	// Rules are threshold alert rules evaluated on every poll, nil disables them
+	Rules *RuleEngine
+	// FrequencyLabels keys the per channel series by frequency instead of the gateway ids
+	FrequencyLabels bool
+	// HealthProfile holds the thresholds channels are graded against, nil means DefaultThresholdProfile
+	HealthProfile *ThresholdProfile
+
+	mu          sync.Mutex
+	counters    counterTracker
+	transitions transitionState
+	// the optional endpoints log a missing one once, older firmwares don't serve them
+	interfaceStatsLogged bool
+	lanPortsLogged       bool
+	voiceLogged          bool
+
+	lastMu         sync.Mutex
+	lastStatus     *ModemStatusData
+	lastStatusTime time.Time
+
+	systemInfoMu     sync.Mutex
+	systemInfo       *SystemInfoData
+	systemInfoTime   time.Time
+	systemInfoLogged bool
 }
 
+// systemInfoTTL is how long the system information is cached, it only changes with firmware upgrades
+const systemInfoTTL = time.Hour
+
 var (
 	loginSuccessDesc    *prometheus.Desc
 	loginMessageDesc    *prometheus.Desc
 	userDesc            *prometheus.Desc
 	uidDesc             *prometheus.Desc
 	defaultPasswordDesc *prometheus.Desc
+	systemInfoDesc      *prometheus.Desc
 
 	centralFrequencyDownstreamDesc *prometheus.Desc
 	powerDownstreamDesc            *prometheus.Desc
@@ -55,35 +94,36 @@ func init() {
 	userDesc = prometheus.NewDesc(prefix+"user_info", "User name as returned by the web interface", []string{"username"}, nil)
 	uidDesc = prometheus.NewDesc(prefix+"uid_info", "User id as returned by the web interface", []string{"uid"}, nil)
 	defaultPasswordDesc = prometheus.NewDesc(prefix+"default_password_bool", "1 if the default password is in use", nil, nil)
+	systemInfoDesc = prometheus.NewDesc(prefix+"system_info", "Model, firmware and hardware version of the gateway", []string{"model", "software_version", "hardware_version"}, nil)
 
 	downstreamChannelLabels := []string{"id", "channel_id", "fft", "channel_type"}
-	centralFrequencyDownstreamDesc = prometheus.NewDesc(prefix+"downstream_central_frequency_hertz", "Central frequency in hertz", downstreamChannelLabels, nil)
-	powerDownstreamDesc = prometheus.NewDesc(prefix+"downstream_power_dBmV", "Power in dBmV", downstreamChannelLabels, nil)
-	snrDownstreamDesc = prometheus.NewDesc(prefix+"downstream_snr_dB", "SNR in dB", downstreamChannelLabels, nil)
-	lockedDownstreamDesc = prometheus.NewDesc(prefix+"downstream_locked_bool", "Locking status", downstreamChannelLabels, nil)
+	centralFrequencyDownstreamDesc = newChannelDesc(prefix+"downstream_central_frequency_hertz", "Central frequency in hertz", downstreamChannelLabels)
+	powerDownstreamDesc = newChannelDesc(prefix+"downstream_power_dBmV", "Power in dBmV", downstreamChannelLabels)
+	snrDownstreamDesc = newChannelDesc(prefix+"downstream_snr_dB", "SNR in dB", downstreamChannelLabels)
+	lockedDownstreamDesc = newChannelDesc(prefix+"downstream_locked_bool", "Locking status", downstreamChannelLabels)
 
 	ofdmDownstreamChannelLabels := []string{"id", "channel_id_ofdm", "fft", "channel_type"}
-	startFrequencyOfdmDownstreamDesc = prometheus.NewDesc(prefix+"ofdm_downstream_start_frequency_hertz", "Start frequency", ofdmDownstreamChannelLabels, nil)
-	endFrequencyOfdmDownstreamDesc = prometheus.NewDesc(prefix+"ofdm_downstream_end_frequency_hertz", "End frequency", ofdmDownstreamChannelLabels, nil)
-	centralFrequencyOfdmDownstreamDesc = prometheus.NewDesc(prefix+"ofdm_downstream_central_frequency_hertz", "Central frequency", ofdmDownstreamChannelLabels, nil)
-	bandwidthOfdmDownstreamDesc = prometheus.NewDesc(prefix+"ofdm_downstream_bandwidth_hertz", "Bandwidth", ofdmDownstreamChannelLabels, nil)
-	powerOfdmDownstreamDesc = prometheus.NewDesc(prefix+"ofdm_downstream_power_dBmV", "Power", ofdmDownstreamChannelLabels, nil)
-	snrOfdmDownstreamDesc = prometheus.NewDesc(prefix+"ofdm_downstream_snr_dB", "SNR", ofdmDownstreamChannelLabels, nil)
-	lockedOfdmDownstreamDesc = prometheus.NewDesc(prefix+"ofdm_downstream_locked_bool", "Locking status", ofdmDownstreamChannelLabels, nil)
+	startFrequencyOfdmDownstreamDesc = newChannelDesc(prefix+"ofdm_downstream_start_frequency_hertz", "Start frequency", ofdmDownstreamChannelLabels)
+	endFrequencyOfdmDownstreamDesc = newChannelDesc(prefix+"ofdm_downstream_end_frequency_hertz", "End frequency", ofdmDownstreamChannelLabels)
+	centralFrequencyOfdmDownstreamDesc = newChannelDesc(prefix+"ofdm_downstream_central_frequency_hertz", "Central frequency", ofdmDownstreamChannelLabels)
+	bandwidthOfdmDownstreamDesc = newChannelDesc(prefix+"ofdm_downstream_bandwidth_hertz", "Bandwidth", ofdmDownstreamChannelLabels)
+	powerOfdmDownstreamDesc = newChannelDesc(prefix+"ofdm_downstream_power_dBmV", "Power", ofdmDownstreamChannelLabels)
+	snrOfdmDownstreamDesc = newChannelDesc(prefix+"ofdm_downstream_snr_dB", "SNR", ofdmDownstreamChannelLabels)
+	lockedOfdmDownstreamDesc = newChannelDesc(prefix+"ofdm_downstream_locked_bool", "Locking status", ofdmDownstreamChannelLabels)
 
 	upstreamLabels := []string{"id", "channel_id_up", "fft", "channel_type"}
-	centralFrequencyUpstreamDesc = prometheus.NewDesc(prefix+"upstream_central_frequency_hertz", "Central frequency", upstreamLabels, nil)
-	powerUpstreamDesc = prometheus.NewDesc(prefix+"upstream_power_dBmV", "Power", upstreamLabels, nil)
+	centralFrequencyUpstreamDesc = newChannelDesc(prefix+"upstream_central_frequency_hertz", "Central frequency", upstreamLabels)
+	powerUpstreamDesc = newChannelDesc(prefix+"upstream_power_dBmV", "Power", upstreamLabels)
 	rangingStatusUpstreamDesc = prometheus.NewDesc(prefix+"upstream_ranging_status_info", "Ranging status", append(upstreamLabels, "status"), nil)
-	lockedUpstreamDesc = prometheus.NewDesc(prefix+"upstream_locked_bool", "Locking status", upstreamLabels, nil)
+	lockedUpstreamDesc = newChannelDesc(prefix+"upstream_locked_bool", "Locking status", upstreamLabels)
 
 	ofdmUpstreamChannelLabels := []string{"id", "channel_id_ofdm", "fft", "channel_type"}
-	startFrequencyOfdmUpstreamDesc = prometheus.NewDesc(prefix+"ofdm_upstream_start_frequency_hertz", "Start frequency", ofdmUpstreamChannelLabels, nil)
-	endFrequencyOfdmUpstreamDesc = prometheus.NewDesc(prefix+"ofdm_upstream_end_frequency_hertz", "End frequency", ofdmUpstreamChannelLabels, nil)
-	centralFrequencyOfdmUpstreamDesc = prometheus.NewDesc(prefix+"ofdm_upstream_central_frequency_hertz", "Central frequency", ofdmUpstreamChannelLabels, nil)
-	bandwidthOfdmUpstreamDesc = prometheus.NewDesc(prefix+"ofdm_upstream_bandwidth_hertz", "Bandwidth", ofdmUpstreamChannelLabels, nil)
-	powerOfdmUpstreamDesc = prometheus.NewDesc(prefix+"ofdm_upstream_power_dBmV", "Power", ofdmUpstreamChannelLabels, nil)
-	lockedOfdmUpstreamDesc = prometheus.NewDesc(prefix+"ofdm_upstream_locked_bool", "Locking status", ofdmUpstreamChannelLabels, nil)
+	startFrequencyOfdmUpstreamDesc = newChannelDesc(prefix+"ofdm_upstream_start_frequency_hertz", "Start frequency", ofdmUpstreamChannelLabels)
+	endFrequencyOfdmUpstreamDesc = newChannelDesc(prefix+"ofdm_upstream_end_frequency_hertz", "End frequency", ofdmUpstreamChannelLabels)
+	centralFrequencyOfdmUpstreamDesc = newChannelDesc(prefix+"ofdm_upstream_central_frequency_hertz", "Central frequency", ofdmUpstreamChannelLabels)
+	bandwidthOfdmUpstreamDesc = newChannelDesc(prefix+"ofdm_upstream_bandwidth_hertz", "Bandwidth", ofdmUpstreamChannelLabels)
+	powerOfdmUpstreamDesc = newChannelDesc(prefix+"ofdm_upstream_power_dBmV", "Power", ofdmUpstreamChannelLabels)
+	lockedOfdmUpstreamDesc = newChannelDesc(prefix+"ofdm_upstream_locked_bool", "Locking status", ofdmUpstreamChannelLabels)
 
 	logoutSuccessDesc = prometheus.NewDesc(prefix+"logout_success_bool", "1 if the logout was successfull", nil, nil)
 	logoutMessageDesc = prometheus.NewDesc(prefix+"logout_message_info", "Logout message returned by the web interface", []string{"message"}, nil)
@@ -96,37 +136,53 @@ func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- userDesc
 	ch <- uidDesc
 	ch <- defaultPasswordDesc
+	ch <- systemInfoDesc
 
-	ch <- centralFrequencyDownstreamDesc
-	ch <- powerDownstreamDesc
-	ch <- snrDownstreamDesc
-	ch <- snrDownstreamDesc
-
-	ch <- startFrequencyOfdmDownstreamDesc
-	ch <- endFrequencyOfdmDownstreamDesc
-	ch <- centralFrequencyOfdmDownstreamDesc
-	ch <- bandwidthOfdmDownstreamDesc
-	ch <- powerOfdmDownstreamDesc
-	ch <- snrOfdmDownstreamDesc
-	ch <- lockedOfdmDownstreamDesc
-
-	ch <- startFrequencyOfdmUpstreamDesc
-	ch <- endFrequencyOfdmUpstreamDesc
-	ch <- centralFrequencyOfdmUpstreamDesc
-	ch <- bandwidthOfdmUpstreamDesc
-	ch <- powerOfdmUpstreamDesc
-	ch <- lockedOfdmUpstreamDesc
-
-	ch <- centralFrequencyUpstreamDesc
-	ch <- powerUpstreamDesc
+	c.describeChannels(ch)
 	ch <- rangingStatusUpstreamDesc
 
+	ch <- lineHealthScoreDesc
+	ch <- channelBaselineDesc
+	ch <- channelAnomalyZScoreDesc
+	ch <- channelAnomalyDesc
+	ch <- ruleStateDesc
+	ch <- downstreamPowerSlopeDesc
+	ch <- downstreamSnrSlopeDesc
+	ch <- downstreamPowerSpreadDesc
+	ch <- downstreamSnrSpreadDesc
+	ch <- downstreamDipsDesc
+	ch <- summaryPowerMinDesc
+	ch <- summaryPowerAvgDesc
+	ch <- summaryPowerMaxDesc
+	ch <- summarySnrMinDesc
+	ch <- summarySnrAvgDesc
+	ch <- summarySnrMaxDesc
+	ch <- summaryChannelsDesc
+	ch <- summaryLockedDesc
+	ch <- summaryOfdmChannelsDesc
+	ch <- summaryScQamChannelsDesc
+	ch <- summarySpectrumDesc
+	ch <- estimatedCapacityDesc
+	ch <- channelChangesDesc
+	ch <- channelLastChangeDesc
+	ch <- outagesDesc
+	ch <- outageSecondsDesc
+	ch <- outageActiveDesc
+
+	describeInterfaceStats(ch)
+	describeLanPorts(ch)
+	describeVoice(ch)
+	ch <- eventLogEntriesDesc
+
 	ch <- logoutSuccessDesc
 	ch <- logoutMessageDesc
 }
 
 // Collect implements prometheus.Collector interface's Collect function
 func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	loginresponse, err := c.Station.Login()
 	if loginresponse != nil {
 		ch <- prometheus.MustNewConstMetric(loginMessageDesc, prometheus.GaugeValue, 1, loginresponse.Message)
@@ -134,64 +190,147 @@ func (c *Collector) Collect(ch chan<- prometheus.Metric) {
 	if err != nil {
 		ch <- prometheus.MustNewConstMetric(loginSuccessDesc, prometheus.GaugeValue, 0)
 		ch <- prometheus.MustNewConstMetric(logoutSuccessDesc, prometheus.GaugeValue, 0)
+		c.collectOutages(ch, err, nil)
+		c.collectRules(ch, nil)
+		c.notify(err, nil, nil, nil)
 		return
 	}
 	ch <- prometheus.MustNewConstMetric(loginSuccessDesc, prometheus.GaugeValue, 1)
 	ch <- prometheus.MustNewConstMetric(userDesc, prometheus.GaugeValue, 1, loginresponse.Data.User)
 	ch <- prometheus.MustNewConstMetric(uidDesc, prometheus.GaugeValue, 1, loginresponse.Data.Uid)
 	ch <- prometheus.MustNewConstMetric(defaultPasswordDesc, prometheus.GaugeValue, bool2float64(loginresponse.Data.DefaultPassword == "Yes"))
+	if info := c.getSystemInfo(); info != nil {
+		ch <- prometheus.MustNewConstMetric(systemInfoDesc, prometheus.GaugeValue, 1, info.ModelName, info.SoftwareVersion, info.HardwareVersion)
+	}
 
 	docsisStatusResponse, err := c.Station.GetModemStatus()
 	if err != nil {
 		fmt.Println(err.Error())
 	}
+	var data *ModemStatusData
+	var changes []*ChannelChange
 	if err == nil && docsisStatusResponse.Data != nil {
+		data = docsisStatusResponse.Data
+		labelers := map[string]*channelLabeler{
+			DirectionDownstream:     c.newChannelLabeler(ch, downstreamChannelInfoDesc),
+			DirectionOfdmDownstream: c.newChannelLabeler(ch, ofdmDownstreamChannelInfoDesc),
+			DirectionUpstream:       c.newChannelLabeler(ch, upstreamChannelInfoDesc),
+			DirectionOfdmUpstream:   c.newChannelLabeler(ch, ofdmUpstreamChannelInfoDesc),
+		}
+		labeler := labelers[DirectionDownstream]
 		for _, downstreamChannel := range docsisStatusResponse.Data.Downstream {
-			labels := []string{downstreamChannel.Id, downstreamChannel.ChannelId, downstreamChannel.Modulation, downstreamChannel.ChannelType}
-			ch <- prometheus.MustNewConstMetric(centralFrequencyDownstreamDesc, prometheus.GaugeValue, parse2float(downstreamChannel.CentralFrequency)*10e9, labels...)
-			ch <- prometheus.MustNewConstMetric(powerDownstreamDesc, prometheus.GaugeValue, parse2float(downstreamChannel.Power), labels...)
-			ch <- prometheus.MustNewConstMetric(snrDownstreamDesc, prometheus.GaugeValue, parse2float(downstreamChannel.Snr), labels...)
-			ch <- prometheus.MustNewConstMetric(lockedDownstreamDesc, prometheus.GaugeValue, bool2float64(downstreamChannel.Locked == "Locked"), labels...)
+			metrics := labeler.channel(downstreamChannel.CentralFrequency, downstreamChannel.Id, downstreamChannel.ChannelId, downstreamChannel.Modulation, downstreamChannel.ChannelType)
+			if metrics == nil {
+				continue
+			}
+			metrics.gauge(centralFrequencyDownstreamDesc, parse2float(downstreamChannel.CentralFrequency)*10e9)
+			metrics.gauge(powerDownstreamDesc, parse2float(downstreamChannel.Power))
+			metrics.gauge(snrDownstreamDesc, parse2float(downstreamChannel.Snr))
+			metrics.gauge(lockedDownstreamDesc, bool2float64(downstreamChannel.Locked == "Locked"))
 		}
+		labeler = labelers[DirectionOfdmDownstream]
 		for _, ofdmDownstreamChannel := range docsisStatusResponse.Data.OfdmDownstreamData {
-			labels := []string{ofdmDownstreamChannel.Id, ofdmDownstreamChannel.ChannelIdOfdm, ofdmDownstreamChannel.FftOfdm, ofdmDownstreamChannel.ChannelType}
-			ch <- prometheus.MustNewConstMetric(startFrequencyOfdmDownstreamDesc, prometheus.GaugeValue, parse2float(ofdmDownstreamChannel.StartFrequency)*10e9, labels...)
-			ch <- prometheus.MustNewConstMetric(endFrequencyOfdmDownstreamDesc, prometheus.GaugeValue, parse2float(ofdmDownstreamChannel.PLCFrequency)*10e9, labels...)
-			ch <- prometheus.MustNewConstMetric(centralFrequencyOfdmDownstreamDesc, prometheus.GaugeValue, parse2float(ofdmDownstreamChannel.CentralFrequencyOfdm)*10e9, labels...)
-			ch <- prometheus.MustNewConstMetric(bandwidthOfdmDownstreamDesc, prometheus.GaugeValue, parse2float(ofdmDownstreamChannel.Bandwidth)*10e9, labels...)
-			ch <- prometheus.MustNewConstMetric(powerOfdmDownstreamDesc, prometheus.GaugeValue, parse2float(ofdmDownstreamChannel.PowerOfdm), labels...)
-			ch <- prometheus.MustNewConstMetric(snrOfdmDownstreamDesc, prometheus.GaugeValue, parse2float(ofdmDownstreamChannel.SnrOfdm), labels...)
-			ch <- prometheus.MustNewConstMetric(lockedOfdmDownstreamDesc, prometheus.GaugeValue, bool2float64(ofdmDownstreamChannel.LockedOfdm == "Locked"), labels...)
+			metrics := labeler.channel(ofdmDownstreamChannel.CentralFrequencyOfdm, ofdmDownstreamChannel.Id, ofdmDownstreamChannel.ChannelIdOfdm, ofdmDownstreamChannel.FftOfdm, ofdmDownstreamChannel.ChannelType)
+			if metrics == nil {
+				continue
+			}
+			metrics.gauge(startFrequencyOfdmDownstreamDesc, parse2float(ofdmDownstreamChannel.StartFrequency)*10e9)
+			metrics.gauge(endFrequencyOfdmDownstreamDesc, parse2float(ofdmDownstreamChannel.PLCFrequency)*10e9)
+			metrics.gauge(centralFrequencyOfdmDownstreamDesc, parse2float(ofdmDownstreamChannel.CentralFrequencyOfdm)*10e9)
+			metrics.gauge(bandwidthOfdmDownstreamDesc, parse2float(ofdmDownstreamChannel.Bandwidth)*10e9)
+			metrics.gauge(powerOfdmDownstreamDesc, parse2float(ofdmDownstreamChannel.PowerOfdm))
+			metrics.gauge(snrOfdmDownstreamDesc, parse2float(ofdmDownstreamChannel.SnrOfdm))
+			metrics.gauge(lockedOfdmDownstreamDesc, bool2float64(ofdmDownstreamChannel.LockedOfdm == "Locked"))
 		}
+		labeler = labelers[DirectionUpstream]
 		for _, upstreamChannel := range docsisStatusResponse.Data.Upstream {
-			labels := []string{upstreamChannel.Id, upstreamChannel.ChannelIdUp, upstreamChannel.SymbolRate, upstreamChannel.ChannelType}
-			ch <- prometheus.MustNewConstMetric(centralFrequencyUpstreamDesc, prometheus.GaugeValue, parse2float(upstreamChannel.CentralFrequency)*10e9, labels...)
-			ch <- prometheus.MustNewConstMetric(powerUpstreamDesc, prometheus.GaugeValue, parse2float(upstreamChannel.Power), labels...)
-			ch <- prometheus.MustNewConstMetric(lockedUpstreamDesc, prometheus.GaugeValue, bool2float64(upstreamChannel.Locked == "Locked"), labels...)
+			metrics := labeler.channel(upstreamChannel.CentralFrequency, upstreamChannel.Id, upstreamChannel.ChannelIdUp, upstreamChannel.SymbolRate, upstreamChannel.ChannelType)
+			if metrics == nil {
+				continue
+			}
+			metrics.gauge(centralFrequencyUpstreamDesc, parse2float(upstreamChannel.CentralFrequency)*10e9)
+			metrics.gauge(powerUpstreamDesc, parse2float(upstreamChannel.Power))
+			metrics.gauge(lockedUpstreamDesc, bool2float64(upstreamChannel.Locked == "Locked"))
 		}
+		labeler = labelers[DirectionOfdmUpstream]
 		for _, ofdmUpstreamChannel := range docsisStatusResponse.Data.OfdmUpstreamData {
-			labels := []string{ofdmUpstreamChannel.Id, ofdmUpstreamChannel.ChannelIdOfdm, ofdmUpstreamChannel.FftOfdm, ofdmUpstreamChannel.ChannelType}
-			ch <- prometheus.MustNewConstMetric(startFrequencyOfdmUpstreamDesc, prometheus.GaugeValue, parse2float(ofdmUpstreamChannel.StartFrequency)*10e9, labels...)
-			ch <- prometheus.MustNewConstMetric(endFrequencyOfdmUpstreamDesc, prometheus.GaugeValue, parse2float(ofdmUpstreamChannel.PLCFrequency)*10e9, labels...)
-			ch <- prometheus.MustNewConstMetric(centralFrequencyOfdmUpstreamDesc, prometheus.GaugeValue, parse2float(ofdmUpstreamChannel.CentralFrequencyOfdm)*10e9, labels...)
-			ch <- prometheus.MustNewConstMetric(bandwidthOfdmUpstreamDesc, prometheus.GaugeValue, parse2float(ofdmUpstreamChannel.Bandwidth)*10e9, labels...)
-			ch <- prometheus.MustNewConstMetric(powerOfdmUpstreamDesc, prometheus.GaugeValue, parse2float(ofdmUpstreamChannel.PowerOfdm), labels...)
-			ch <- prometheus.MustNewConstMetric(lockedOfdmUpstreamDesc, prometheus.GaugeValue, bool2float64(ofdmUpstreamChannel.LockedOfdm == "Locked"), labels...)
+			metrics := labeler.channel(ofdmUpstreamChannel.CentralFrequencyOfdm, ofdmUpstreamChannel.Id, ofdmUpstreamChannel.ChannelIdOfdm, ofdmUpstreamChannel.FftOfdm, ofdmUpstreamChannel.ChannelType)
+			if metrics == nil {
+				continue
+			}
+			metrics.gauge(startFrequencyOfdmUpstreamDesc, parse2float(ofdmUpstreamChannel.StartFrequency)*10e9)
+			metrics.gauge(endFrequencyOfdmUpstreamDesc, parse2float(ofdmUpstreamChannel.PLCFrequency)*10e9)
+			metrics.gauge(centralFrequencyOfdmUpstreamDesc, parse2float(ofdmUpstreamChannel.CentralFrequencyOfdm)*10e9)
+			metrics.gauge(bandwidthOfdmUpstreamDesc, parse2float(ofdmUpstreamChannel.Bandwidth)*10e9)
+			metrics.gauge(powerOfdmUpstreamDesc, parse2float(ofdmUpstreamChannel.PowerOfdm))
+			metrics.gauge(lockedOfdmUpstreamDesc, bool2float64(ofdmUpstreamChannel.LockedOfdm == "Locked"))
 		}
+		c.collectHealth(ch, docsisStatusResponse.Data, labelers)
+		c.collectAnomalies(ch, docsisStatusResponse.Data)
+		c.collectSpectrum(ch, docsisStatusResponse.Data)
+		c.collectSummary(ch, docsisStatusResponse.Data)
+		c.collectCapacity(ch, docsisStatusResponse.Data)
+		changes = c.collectChannelChanges(ch, docsisStatusResponse.Data)
+		c.setLastModemStatus(docsisStatusResponse.Data)
+		c.recordHistory(docsisStatusResponse.Data)
 	}
 
+	c.collectOutages(ch, nil, data)
+	c.collectRules(ch, data)
+	c.notify(nil, loginresponse.Data, data, changes)
+
+	c.collectInterfaceStats(ch)
+	c.collectLanPorts(ch)
+	c.collectVoice(ch)
+	c.collectEventLog(ch)
+
 	logoutresponse, err := c.Station.Logout()
 	if logoutresponse != nil {
 		ch <- prometheus.MustNewConstMetric(logoutMessageDesc, prometheus.GaugeValue, 1, logoutresponse.Message)
 	}
-	if err != nil {
-		ch <- prometheus.MustNewConstMetric(logoutSuccessDesc, prometheus.GaugeValue, 0)
+	ch <- prometheus.MustNewConstMetric(logoutSuccessDesc, prometheus.GaugeValue, bool2float64(err == nil))
+}
+
+// getSystemInfo returns the cached system information, fetching it again once it's older than
+// systemInfoTTL. It's nil for older firmwares, which don't serve it.
+func (c *Collector) getSystemInfo() *SystemInfoData {
+	c.systemInfoMu.Lock()
+	defer c.systemInfoMu.Unlock()
+
+	if !c.systemInfoTime.IsZero() && time.Since(c.systemInfoTime) < systemInfoTTL {
+		return c.systemInfo
 	}
-	ch <- prometheus.MustNewConstMetric(logoutSuccessDesc, prometheus.GaugeValue, 1)
+	c.systemInfoTime = time.Now()
+	systemInfoResponse, err := c.Station.GetSystemInfo()
+	switch {
+	case err != nil && !c.systemInfoLogged:
+		log.Warnf("error fetching system info, the firmware might not support it: %s", err.Error())
+		c.systemInfoLogged = true
+	case err != nil:
+		log.Debugf("error fetching system info: %s", err.Error())
+	case systemInfoResponse.Data != nil:
+		c.systemInfo = systemInfoResponse.Data
+	}
+	return c.systemInfo
+}
+
+// LastModemStatus returns the modem status of the latest collection and when it was fetched.
+// The status is nil until the first successful collection.
+func (c *Collector) LastModemStatus() (*ModemStatusData, time.Time) {
+	c.lastMu.Lock()
+	defer c.lastMu.Unlock()
+	return c.lastStatus, c.lastStatusTime
+}
+
+func (c *Collector) setLastModemStatus(data *ModemStatusData) {
+	c.lastMu.Lock()
+	defer c.lastMu.Unlock()
+	c.lastStatus = data
+	c.lastStatusTime = time.Now()
 }
 
 func parse2float(str string) float64 {
-	reg := regexp.MustCompile(`[^\.0-9]+`)
+	reg := regexp.MustCompile(`[^\-\.0-9]+`)
 	processedString := reg.ReplaceAllString(str, "")
 	value, err := strconv.ParseFloat(processedString, 64)
 	if err != nil {
@@ -0,0 +1,220 @@
+package collector_test
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/reynico/fibertel-station-exporter/collector"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestCollect(t *testing.T) {
+	station := newTestStation(t, newTestModemStatusData())
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(&collector.Collector{
+		Station: collector.NewFibertelStation(station.URL, "custadmin", "password"),
+	})
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, family := range families {
+		if family.GetName() == "fibertel_downstream_locked_bool" {
+			found = len(family.Metric) == 4
+		}
+	}
+	if !found {
+		t.Errorf("expected the lock status of 4 downstream channels")
+	}
+}
+
+func TestCollectFrequencyLabels(t *testing.T) {
+	station := newTestStation(t, newTestModemStatusData())
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(&collector.Collector{
+		Station:         collector.NewFibertelStation(station.URL, "custadmin", "password"),
+		FrequencyLabels: true,
+	})
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	labels := make(map[string][]map[string]string)
+	for _, family := range families {
+		for _, metric := range family.Metric {
+			metricLabels := make(map[string]string)
+			for _, label := range metric.Label {
+				metricLabels[label.GetName()] = label.GetValue()
+			}
+			labels[family.GetName()] = append(labels[family.GetName()], metricLabels)
+		}
+	}
+
+	power := labels["fibertel_downstream_power_dBmV"]
+	if len(power) != 4 {
+		t.Fatalf("expected 4 downstream power series, got %v", power)
+	}
+	for _, metricLabels := range power {
+		if len(metricLabels) != 1 || metricLabels["frequency_mhz"] == "" {
+			t.Errorf("expected power to be labelled by frequency only, got %v", metricLabels)
+		}
+	}
+	info := labels["fibertel_downstream_channel_info"]
+	if len(info) != 4 || info[0]["frequency_mhz"] != "603" || info[0]["channel_id"] != "1" {
+		t.Errorf("expected the channel ids in the info metric, got %v", info)
+	}
+	if upstream := labels["fibertel_upstream_locked_bool"]; len(upstream) != 2 || upstream[0]["frequency_mhz"] != "30.6" {
+		t.Errorf("expected upstream lock status labelled by frequency, got %v", upstream)
+	}
+	health := labels["fibertel_channel_health"]
+	if len(health) == 0 {
+		t.Fatal("expected the channel health")
+	}
+	found := false
+	for _, metricLabels := range health {
+		if len(metricLabels) != 3 || metricLabels["frequency_mhz"] == "" || metricLabels["direction"] == "" || metricLabels["check"] == "" {
+			t.Errorf("expected the channel health to be labelled by frequency, got %v", metricLabels)
+		}
+		found = found || (metricLabels["direction"] == "downstream" && metricLabels["frequency_mhz"] == "609" && metricLabels["check"] == "snr")
+	}
+	if !found {
+		t.Errorf("expected the SNR health of the downstream channel on 609 MHz, got %v", health)
+	}
+}
+
+func TestCollectNegativePower(t *testing.T) {
+	data := newTestModemStatusData()
+	data.Downstream[0].Power = "-12.3 dBmV"
+	station := newTestStation(t, data)
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(&collector.Collector{
+		Station: collector.NewFibertelStation(station.URL, "custadmin", "password"),
+	})
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	powers := make(map[string]float64)
+	for _, family := range families {
+		if family.GetName() != "fibertel_downstream_power_dBmV" {
+			continue
+		}
+		for _, metric := range family.Metric {
+			for _, label := range metric.Label {
+				if label.GetName() == "channel_id" {
+					powers[label.GetValue()] = metric.GetGauge().GetValue()
+				}
+			}
+		}
+	}
+	// the sign is kept, older versions exported the absolute value
+	expected := map[string]float64{"1": -12.3, "2": -8.1, "3": 1}
+	for channelId, power := range expected {
+		if powers[channelId] != power {
+			t.Errorf("expected channel %s to have a power of %g dBmV, got %g", channelId, power, powers[channelId])
+		}
+	}
+}
+
+func TestCollectCachesSystemInfo(t *testing.T) {
+	station := newTestStation(t, newTestModemStatusData())
+	requests := 0
+	handler := station.Config.Handler
+	station.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/v1/system/") {
+			requests++
+		}
+		handler.ServeHTTP(w, r)
+	})
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(&collector.Collector{
+		Station: collector.NewFibertelStation(station.URL, "custadmin", "password"),
+	})
+	for i := 0; i < 3; i++ {
+		families, err := registry.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		found := false
+		for _, family := range families {
+			found = found || family.GetName() == "fibertel_system_info"
+		}
+		if !found {
+			t.Errorf("expected the system info on every scrape")
+		}
+	}
+	if requests != 1 {
+		t.Errorf("expected the system info to be fetched once, got %d requests", requests)
+	}
+}
+
+func TestCollectFailedLogout(t *testing.T) {
+	station := newTestStation(t, newTestModemStatusData())
+	handler := station.Config.Handler
+	station.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v1/session/logout" {
+			w.Write([]byte(`{"error":"error","message":"session expired"}`))
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(&collector.Collector{
+		Station: collector.NewFibertelStation(station.URL, "custadmin", "password"),
+	})
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		if family.GetName() == "fibertel_logout_success_bool" {
+			if len(family.Metric) != 1 || family.Metric[0].GetGauge().GetValue() != 0 {
+				t.Errorf("expected a single failed logout, got %+v", family.Metric)
+			}
+			return
+		}
+	}
+	t.Errorf("expected the logout result")
+}
+
+type recordingNotifier struct {
+	kinds []string
+}
+
+func (n *recordingNotifier) Notify(notification *collector.Notification) {
+	for _, event := range notification.Events {
+		n.kinds = append(n.kinds, event.Kind)
+	}
+}
+
+func TestCollectUnreachableEvents(t *testing.T) {
+	station := newTestStation(t, newTestModemStatusData())
+	var unreachable atomic.Bool
+	handler := station.Config.Handler
+	station.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if unreachable.Load() {
+			// drops the connection without a response
+			panic(http.ErrAbortHandler)
+		}
+		handler.ServeHTTP(w, r)
+	})
+	notifier := &recordingNotifier{}
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(&collector.Collector{
+		Station:   collector.NewFibertelStation(station.URL, "custadmin", "password"),
+		Notifiers: []collector.Notifier{notifier},
+	})
+	for _, down := range []bool{false, true, true, false} {
+		unreachable.Store(down)
+		if _, err := registry.Gather(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected := []string{collector.EventGatewayUnreachable, collector.EventGatewayReachable}
+	if strings.Join(notifier.kinds, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected %v, got %v", expected, notifier.kinds)
+	}
+}
@@ -0,0 +1,105 @@
+package collector
+
+import (
+	"sort"
+	"strings"
+)
+
+// Likely causes of DOCSIS events
+const (
+	CauseUpstream     = "upstream"
+	CauseDownstream   = "downstream"
+	CauseProvisioning = "provisioning"
+	CauseFirmware     = "firmware"
+	CauseInformation  = "information"
+)
+
+// EventCode describes a standard DOCSIS event as listed in the OSSI specification
+type EventCode struct {
+	Id          string `json:"id"`
+	Description string `json:"description"`
+	Severity    string `json:"severity"`
+	Cause       string `json:"cause"`
+	Action      string `json:"action"`
+}
+
+const (
+	upstreamAction     = "Check for ingress noise on the upstream: loose or corroded connectors, unterminated outlets and damaged cables. If it keeps happening with a clean in-home installation, report it to the ISP."
+	downstreamAction   = "Check the downstream power levels and the coax path for bad splitters or connectors. Losing sync repeatedly usually needs a technician visit."
+	provisioningAction = "The modem could not complete provisioning with the ISP. This is usually an ISP side problem, open a ticket if it persists."
+)
+
+var eventCodes = []*EventCode{
+	{"82000200", "No Ranging Response received - T3 time-out", "critical", CauseUpstream, upstreamAction},
+	{"82000300", "Ranging Request Retries exhausted", "critical", CauseUpstream, upstreamAction},
+	{"82000400", "Received Response to Broadcast Maintenance Request, But no Unicast Maintenance opportunities received - T4 time out", "critical", CauseUpstream, upstreamAction},
+	{"82000500", "Started Unicast Maintenance Ranging - no Response received - T3 time-out", "critical", CauseUpstream, upstreamAction},
+	{"82000600", "Unicast Maintenance Ranging attempted - No response - Retries exhausted", "critical", CauseUpstream, upstreamAction},
+	{"82000700", "Unicast Ranging Received Abort Response - Re-initializing MAC", "critical", CauseUpstream, upstreamAction},
+	{"85010100", "TCS Fail on all Upstream Channels", "critical", CauseUpstream, upstreamAction},
+	{"85010200", "TCS Partial Service", "warning", CauseUpstream, upstreamAction},
+	{"2436694061", "Dynamic Range Window violation", "warning", CauseUpstream, "The upstream channels are transmitting at too different power levels. Check for tilt or attenuation on the upstream path."},
+	{"84000100", "SYNC Timing Synchronization failure - Failed to acquire QAM/QPSK symbol timing", "critical", CauseDownstream, downstreamAction},
+	{"84000200", "SYNC Timing Synchronization failure - Failed to acquire FEC framing", "critical", CauseDownstream, downstreamAction},
+	{"84000300", "SYNC Timing Synchronization failure - Acquired FEC framing - Failed to acquire MPEG2 Sync", "critical", CauseDownstream, downstreamAction},
+	{"84000500", "SYNC Timing Synchronization failure - Loss of Sync", "critical", CauseDownstream, downstreamAction},
+	{"84020200", "Lost MDD Timeout", "warning", CauseDownstream, downstreamAction},
+	{"84020300", "MDD message timeout", "warning", CauseDownstream, downstreamAction},
+	{"68000100", "DHCP FAILED - Discover sent, no offer received", "critical", CauseProvisioning, provisioningAction},
+	{"68000300", "DHCP FAILED - Request sent, No response", "critical", CauseProvisioning, provisioningAction},
+	{"68010100", "DHCP RENEW sent - No response for IPv4", "error", CauseProvisioning, provisioningAction},
+	{"68010300", "DHCP REBIND sent - No response for IPv4", "error", CauseProvisioning, provisioningAction},
+	{"69010100", "SW Download INIT - Via NMS", "notice", CauseFirmware, "The ISP started a firmware upgrade, expect a reboot."},
+	{"69010200", "SW Download INIT - Via Config file", "notice", CauseFirmware, "The ISP started a firmware upgrade, expect a reboot."},
+	{"74010100", "CM-STATUS message sent", "notice", CauseInformation, "None, the modem reported a status change to the CMTS. Look at the surrounding entries."},
+	{"90000000", "MIMO Event MIMO", "notice", CauseInformation, "None, informational message logged during registration."},
+}
+
+var eventCodesById map[string]*EventCode
+
+func init() {
+	eventCodesById = make(map[string]*EventCode, len(eventCodes))
+	for _, eventCode := range eventCodes {
+		eventCodesById[eventCode.Id] = eventCode
+	}
+}
+
+// EventCodes returns all known event codes sorted by id
+func EventCodes() []*EventCode {
+	codes := make([]*EventCode, len(eventCodes))
+	copy(codes, eventCodes)
+	sort.Slice(codes, func(i, j int) bool {
+		return codes[i].Id < codes[j].Id
+	})
+	return codes
+}
+
+// LookupEventCode returns the event code with the given id, or nil if it is unknown
+func LookupEventCode(id string) *EventCode {
+	return eventCodesById[strings.TrimSpace(id)]
+}
+
+// ClassifyEventText returns the event code whose description matches the event log text.
+// Gateways often log the text without the numeric id, e.g. "T3 time-out; CM-MAC=...".
+func ClassifyEventText(text string) *EventCode {
+	text = strings.ToLower(text)
+	var match *EventCode
+	for _, eventCode := range eventCodes {
+		if strings.Contains(text, strings.ToLower(eventCode.Description)) && (match == nil || len(eventCode.Description) > len(match.Description)) {
+			match = eventCode
+		}
+	}
+	if match != nil {
+		return match
+	}
+	// fall back to the well known short forms
+	switch {
+	case strings.Contains(text, "t3 time-out") || strings.Contains(text, "t3 timeout"):
+		return eventCodesById["82000200"]
+	case strings.Contains(text, "t4 time-out") || strings.Contains(text, "t4 time out") || strings.Contains(text, "t4 timeout"):
+		return eventCodesById["82000400"]
+	case strings.Contains(text, "loss of sync"):
+		return eventCodesById["84000500"]
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package collector_test
+
+import (
+	"github.com/reynico/fibertel-station-exporter/collector"
+	"testing"
+)
+
+func TestLookupEventCode(t *testing.T) {
+	eventCode := collector.LookupEventCode("82000200")
+	if eventCode == nil || eventCode.Cause != collector.CauseUpstream {
+		t.Errorf("expected 82000200 to be an upstream event, got %+v", eventCode)
+	}
+	if collector.LookupEventCode("12345678") != nil {
+		t.Errorf("expected unknown event code to return nil")
+	}
+}
+
+func TestClassifyEventText(t *testing.T) {
+	texts := map[string]string{
+		"Started Unicast Maintenance Ranging - no Response received - T3 time-out;CM-MAC=00:11:22:33:44:55;": "82000500",
+		"No Ranging Response received - T3 time-out;CM-MAC=00:11:22:33:44:55;":                               "82000200",
+		"T3 time-out; CM-MAC=00:11:22:33:44:55":                                                              "82000200",
+		"SYNC Timing Synchronization failure - Loss of Sync;CM-MAC=00:11:22:33:44:55;":                       "84000500",
+	}
+	for text, expected := range texts {
+		eventCode := collector.ClassifyEventText(text)
+		if eventCode == nil || eventCode.Id != expected {
+			t.Errorf("ClassifyEventText(%q) = %+v, expected %s", text, eventCode, expected)
+		}
+	}
+	if collector.ClassifyEventText("Honoring MDD; IP provisioning mode = IPv6") != nil {
+		t.Errorf("expected unrelated text not to be classified")
+	}
+}
@@ -0,0 +1,187 @@
+package collector
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var eventLogEntriesDesc *prometheus.Desc
+
+func init() {
+	eventLogEntriesDesc = prometheus.NewDesc(prefix+"event_log_entries_total", "Number of new entries in the gateway event log", []string{"priority", "event_id", "severity", "cause"}, nil)
+}
+
+const maxRecentEventLogRecords = 100
+
+var (
+	eventIdRegex       = regexp.MustCompile(`\b[0-9]{8,10}\b`)
+	eventPriorityRegex = regexp.MustCompile(`[A-Za-z]+`)
+	eventPriorityNames = []string{"", "emergency", "alert", "critical", "error", "warning", "notice", "information", "debug"}
+)
+
+// EventLog keeps track of the gateway event log between polls. The gateway returns its whole
+// log on every request, so entries are deduplicated by timestamp and text before they are counted.
+type EventLog struct {
+	mu       sync.Mutex
+	seen     map[string]bool
+	polled   bool
+	counts   map[eventLogCountKey]float64
+	recent   []*EventLogRecord
+	shippers []*eventShipper
+}
+
+type eventLogCountKey struct {
+	priority string
+	eventId  string
+	severity string
+	cause    string
+}
+
+// EventLogRecord is a deduplicated event log entry
+type EventLogRecord struct {
+	Time      string     `json:"time"`
+	Priority  string     `json:"priority"`
+	EventId   string     `json:"event_id"`
+	Text      string     `json:"text"`
+	Code      *EventCode `json:"code,omitempty"`
+	FirstSeen time.Time  `json:"first_seen"`
+}
+
+func NewEventLog() *EventLog {
+	return &EventLog{
+		seen:   make(map[string]bool),
+		counts: make(map[eventLogCountKey]float64),
+	}
+}
+
+// AddSink forwards new records to the sink, e.g. syslog or Loki, in the background. The records of
+// the first poll are the log from before the exporter started and aren't forwarded, so a restart
+// doesn't ship the whole log again.
+func (l *EventLog) AddSink(sink EventSink) {
+	shipper := newEventShipper(sink)
+	l.mu.Lock()
+	l.shippers = append(l.shippers, shipper)
+	l.mu.Unlock()
+	go shipper.run()
+}
+
+// Update records the entries that were not part of the previous poll and returns them
+func (l *EventLog) Update(entries []*EventLogEntry) []*EventLogRecord {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	seen := make(map[string]bool, len(entries))
+	var added []*EventLogRecord
+	for _, entry := range entries {
+		key := entry.Time + "\x00" + entry.Text
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		if l.seen[key] {
+			continue
+		}
+		record := &EventLogRecord{
+			Time:      entry.Time,
+			Priority:  normalizeEventPriority(entry.Priority),
+			EventId:   eventIdOf(entry),
+			Text:      entry.Text,
+			FirstSeen: now,
+		}
+		record.Code = LookupEventCode(record.EventId)
+		if record.Code == nil {
+			record.Code = ClassifyEventText(entry.Text)
+		}
+		countKey := eventLogCountKey{priority: record.Priority, eventId: record.EventId}
+		if record.Code != nil {
+			record.EventId = record.Code.Id
+			countKey = eventLogCountKey{record.Priority, record.Code.Id, record.Code.Severity, record.Code.Cause}
+		}
+		l.counts[countKey]++
+		added = append(added, record)
+	}
+	// an empty response most likely means the request failed halfway, so keep the old state
+	if len(entries) > 0 {
+		l.seen = seen
+		for _, shipper := range l.shippers {
+			if l.polled {
+				shipper.enqueue(added)
+			}
+			// records a sink failed to take before are retried on every poll
+			shipper.wake()
+		}
+		l.polled = true
+	}
+
+	l.recent = append(l.recent, added...)
+	if len(l.recent) > maxRecentEventLogRecords {
+		l.recent = l.recent[len(l.recent)-maxRecentEventLogRecords:]
+	}
+	return added
+}
+
+// Recent returns the latest event log records, newest first
+func (l *EventLog) Recent() []*EventLogRecord {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	records := make([]*EventLogRecord, len(l.recent))
+	for i, record := range l.recent {
+		records[len(l.recent)-1-i] = record
+	}
+	return records
+}
+
+func (l *EventLog) collect(ch chan<- prometheus.Metric) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for key, count := range l.counts {
+		ch <- prometheus.MustNewConstMetric(eventLogEntriesDesc, prometheus.CounterValue, count, key.priority, key.eventId, key.severity, key.cause)
+	}
+}
+
+func (c *Collector) collectEventLog(ch chan<- prometheus.Metric) {
+	if c.EventLog == nil {
+		return
+	}
+	eventLogResponse, err := c.Station.GetEventLog()
+	if err != nil {
+		log.Errorf("error getting event log: %s", err.Error())
+	} else if eventLogResponse.Data != nil {
+		c.EventLog.Update(eventLogResponse.Data.Entries)
+	}
+	c.EventLog.collect(ch)
+}
+
+// normalizeEventPriority turns priorities like "Critical (3)", "critical" or "3" into "critical"
+func normalizeEventPriority(priority string) string {
+	if name := eventPriorityRegex.FindString(priority); name != "" {
+		return strings.ToLower(name)
+	}
+	level, err := strconv.Atoi(strings.TrimSpace(priority))
+	if err != nil || level <= 0 || level >= len(eventPriorityNames) {
+		return "unknown"
+	}
+	return eventPriorityNames[level]
+}
+
+// eventIdOf returns the id the gateway reported, or else a known event code found in the text.
+// Other numbers of that length in the text are phone numbers, serials or timestamps, not ids.
+func eventIdOf(entry *EventLogEntry) string {
+	if entry.EventId != "" {
+		return entry.EventId
+	}
+	for _, eventId := range eventIdRegex.FindAllString(entry.Text, -1) {
+		if LookupEventCode(eventId) != nil {
+			return eventId
+		}
+	}
+	return "unknown"
+}
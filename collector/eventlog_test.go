@@ -0,0 +1,50 @@
+package collector_test
+
+import (
+	"github.com/reynico/fibertel-station-exporter/collector"
+	"testing"
+)
+
+func TestEventLogDeduplication(t *testing.T) {
+	eventLog := collector.NewEventLog()
+	firstPoll := []*collector.EventLogEntry{
+		{Time: "01/02/2024 10:00:00", Priority: "Critical (3)", Text: "No Ranging Response received - T3 time-out;CM-MAC=00:11:22:33:44:55;"},
+		{Time: "01/02/2024 10:00:00", Priority: "Critical (3)", Text: "No Ranging Response received - T3 time-out;CM-MAC=00:11:22:33:44:55;"},
+	}
+	added := eventLog.Update(firstPoll)
+	if len(added) != 1 {
+		t.Fatalf("expected 1 new entry, got %d", len(added))
+	}
+	if added[0].Priority != "critical" {
+		t.Errorf("expected priority critical, got %s", added[0].Priority)
+	}
+	if added[0].EventId != "82000200" || added[0].Code == nil {
+		t.Errorf("expected the T3 time-out to be classified as 82000200, got %s", added[0].EventId)
+	}
+
+	secondPoll := append(firstPoll, &collector.EventLogEntry{Time: "01/02/2024 10:05:00", Priority: "5", EventId: "84020200", Text: "Lost MDD Timeout"})
+	added = eventLog.Update(secondPoll)
+	if len(added) != 1 || added[0].EventId != "84020200" || added[0].Priority != "warning" {
+		t.Errorf("expected only the lost MDD entry to be new, got %+v", added)
+	}
+	if recent := eventLog.Recent(); len(recent) != 2 || recent[0].EventId != "84020200" {
+		t.Errorf("expected 2 recent entries newest first, got %+v", recent)
+	}
+}
+
+func TestEventLogIdInText(t *testing.T) {
+	eventLog := collector.NewEventLog()
+	added := eventLog.Update([]*collector.EventLogEntry{
+		{Time: "01/02/2024 10:00:00", Priority: "6", Text: "MTA line 1145678901 registered at 1704189600"},
+		{Time: "01/02/2024 10:01:00", Priority: "3", Text: "Event 1145678901 84020200 logged"},
+	})
+	if len(added) != 2 {
+		t.Fatalf("expected 2 new entries, got %d", len(added))
+	}
+	if added[0].EventId != "unknown" {
+		t.Errorf("expected phone numbers and timestamps not to be taken for event ids, got %s", added[0].EventId)
+	}
+	if added[1].EventId != "84020200" {
+		t.Errorf("expected the known event code in the text, got %s", added[1].EventId)
+	}
+}
@@ -0,0 +1,260 @@
+package collector
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/prometheus/common/log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EventSink receives the event log records that were not seen before
+type EventSink interface {
+	Ship(records []*EventLogRecord) error
+}
+
+// maxPendingEventLogRecords bounds the records kept for a sink that can't be reached
+const maxPendingEventLogRecords = 1000
+
+// eventShipper forwards records to a sink outside of scrapes, so a slow sink doesn't hold them up.
+// Records stay queued until the sink took them.
+type eventShipper struct {
+	sink    EventSink
+	signal  chan struct{}
+	mu      sync.Mutex
+	pending []*EventLogRecord
+}
+
+func newEventShipper(sink EventSink) *eventShipper {
+	return &eventShipper{sink: sink, signal: make(chan struct{}, 1)}
+}
+
+func (s *eventShipper) enqueue(records []*EventLogRecord) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending = append(s.pending, records...)
+	if dropped := len(s.pending) - maxPendingEventLogRecords; dropped > 0 {
+		log.Errorf("event log sink is unavailable, dropping %d records", dropped)
+		s.pending = s.pending[dropped:]
+	}
+}
+
+// wake makes the shipper try to ship the pending records, unless it's busy already
+func (s *eventShipper) wake() {
+	select {
+	case s.signal <- struct{}{}:
+	default:
+	}
+}
+
+func (s *eventShipper) run() {
+	for range s.signal {
+		s.mu.Lock()
+		records := s.pending
+		s.mu.Unlock()
+		if len(records) == 0 {
+			continue
+		}
+		if err := s.sink.Ship(records); err != nil {
+			log.Errorf("error shipping event log: %s", err.Error())
+			continue
+		}
+		shipped := make(map[*EventLogRecord]bool, len(records))
+		for _, record := range records {
+			shipped[record] = true
+		}
+		// records may have been added or dropped meanwhile
+		s.mu.Lock()
+		var pending []*EventLogRecord
+		for _, record := range s.pending {
+			if !shipped[record] {
+				pending = append(pending, record)
+			}
+		}
+		s.pending = pending
+		s.mu.Unlock()
+	}
+}
+
+// syslog severities keyed by the DOCSIS priority names in eventPriorityNames
+var syslogSeverities = map[string]int{
+	"emergency":   0,
+	"alert":       1,
+	"critical":    2,
+	"error":       3,
+	"warning":     4,
+	"notice":      5,
+	"information": 6,
+	"debug":       7,
+}
+
+const (
+	syslogFacilityLocal0 = 16
+	syslogAppName        = "fibertel-station-exporter"
+	// private enterprise number reserved for documentation (RFC 5612)
+	syslogStructuredDataId = "fibertel@32473"
+)
+
+// SyslogSink ships event log records as RFC 5424 messages over UDP or TCP.
+// TCP messages use octet counting framing (RFC 6587).
+type SyslogSink struct {
+	network string
+	address string
+	gateway string
+}
+
+// NewSyslogSink creates a sink for addresses like udp://syslog:514 or tcp://syslog:601
+func NewSyslogSink(address, gateway string) (*SyslogSink, error) {
+	parsedAddress, err := url.Parse(address)
+	if err != nil {
+		return nil, err
+	}
+	if parsedAddress.Scheme != "udp" && parsedAddress.Scheme != "tcp" {
+		return nil, fmt.Errorf("unsupported syslog protocol %q, expected udp or tcp", parsedAddress.Scheme)
+	}
+	return &SyslogSink{
+		network: parsedAddress.Scheme,
+		address: parsedAddress.Host,
+		gateway: gateway,
+	}, nil
+}
+
+func (s *SyslogSink) Ship(records []*EventLogRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+	conn, err := net.DialTimeout(s.network, s.address, 5*time.Second)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	for _, record := range records {
+		message := s.format(record)
+		if s.network == "tcp" {
+			message = strconv.Itoa(len(message)) + " " + message
+		}
+		if _, err := conn.Write([]byte(message)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SyslogSink) format(record *EventLogRecord) string {
+	severity, ok := syslogSeverities[recordSeverity(record)]
+	if !ok {
+		severity = syslogSeverities["notice"]
+	}
+	hostname := s.gateway
+	if hostname == "" {
+		hostname, _ = os.Hostname()
+	}
+	structuredData := fmt.Sprintf(`[%s gateway="%s" severity="%s" event_id="%s" time="%s"]`, syslogStructuredDataId,
+		escapeSyslogParam(s.gateway), escapeSyslogParam(recordSeverity(record)), escapeSyslogParam(record.EventId), escapeSyslogParam(record.Time))
+	return fmt.Sprintf("<%d>1 %s %s %s - %s %s %s",
+		syslogFacilityLocal0*8+severity,
+		record.FirstSeen.Format(time.RFC3339),
+		syslogHeaderField(hostname),
+		syslogAppName,
+		syslogHeaderField(record.EventId),
+		structuredData,
+		record.Text)
+}
+
+func syslogHeaderField(str string) string {
+	str = strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' {
+			return -1
+		}
+		return r
+	}, str)
+	if str == "" {
+		return "-"
+	}
+	return str
+}
+
+func escapeSyslogParam(str string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(str)
+}
+
+// LokiSink ships event log records to the Loki push API
+type LokiSink struct {
+	url     string
+	gateway string
+	client  *http.Client
+}
+
+// NewLokiSink creates a sink for a push URL like http://loki:3100/loki/api/v1/push
+func NewLokiSink(pushUrl, gateway string) *LokiSink {
+	return &LokiSink{
+		url:     pushUrl,
+		gateway: gateway,
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+type lokiPushRequest struct {
+	Streams []*lokiStream `json:"streams"`
+}
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+func (s *LokiSink) Ship(records []*EventLogRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+	streams := make(map[string]*lokiStream)
+	pushRequest := &lokiPushRequest{}
+	for i, record := range records {
+		labels := map[string]string{
+			"job":      syslogAppName,
+			"gateway":  s.gateway,
+			"severity": recordSeverity(record),
+			"event_id": record.EventId,
+		}
+		key := labels["severity"] + "\x00" + labels["event_id"]
+		stream, ok := streams[key]
+		if !ok {
+			stream = &lokiStream{Stream: labels}
+			streams[key] = stream
+			pushRequest.Streams = append(pushRequest.Streams, stream)
+		}
+		// records of one poll share the same timestamp, keep them apart so Loki doesn't drop any
+		timestamp := record.FirstSeen.UnixNano() + int64(i)
+		stream.Values = append(stream.Values, [2]string{strconv.FormatInt(timestamp, 10), record.Time + " " + record.Text})
+	}
+
+	body, err := json.Marshal(pushRequest)
+	if err != nil {
+		return err
+	}
+	response, err := s.client.Post(s.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode/100 != 2 {
+		return fmt.Errorf("loki push failed with status %s", response.Status)
+	}
+	return nil
+}
+
+// recordSeverity prefers the severity of the known event code over the gateway priority
+func recordSeverity(record *EventLogRecord) string {
+	if record.Code != nil {
+		return record.Code.Severity
+	}
+	return record.Priority
+}
@@ -0,0 +1,193 @@
+package collector_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/reynico/fibertel-station-exporter/collector"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestRecords() []*collector.EventLogRecord {
+	eventLog := collector.NewEventLog()
+	return eventLog.Update([]*collector.EventLogEntry{
+		{Time: "01/02/2024 10:00:00", Priority: "Critical (3)", Text: "No Ranging Response received - T3 time-out;CM-MAC=00:11:22:33:44:55;"},
+		{Time: "01/02/2024 10:05:00", Priority: "Notice (6)", Text: "Honoring MDD; IP provisioning mode = IPv6"},
+	})
+}
+
+func TestSyslogSinkUDP(t *testing.T) {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	sink, err := collector.NewSyslogSink("udp://"+listener.LocalAddr().String(), "192.168.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Ship(newTestRecords()); err != nil {
+		t.Fatal(err)
+	}
+
+	listener.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buffer := make([]byte, 2048)
+	n, _, err := listener.ReadFrom(buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	message := string(buffer[:n])
+	// local0.crit = 16*8+2
+	if !strings.HasPrefix(message, "<130>1 ") {
+		t.Errorf("unexpected syslog header: %s", message)
+	}
+	if !strings.Contains(message, `gateway="192.168.0.1" severity="critical" event_id="82000200"`) {
+		t.Errorf("structured data is missing labels: %s", message)
+	}
+	if !strings.HasSuffix(message, "No Ranging Response received - T3 time-out;CM-MAC=00:11:22:33:44:55;") {
+		t.Errorf("message text is missing: %s", message)
+	}
+}
+
+func TestSyslogSinkTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	received := make(chan []string)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			close(received)
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		var messages []string
+		for i := 0; i < 2; i++ {
+			message, err := readOctetCountedMessage(reader)
+			if err != nil {
+				break
+			}
+			messages = append(messages, message)
+		}
+		received <- messages
+	}()
+
+	sink, err := collector.NewSyslogSink("tcp://"+listener.Addr().String(), "192.168.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Ship(newTestRecords()); err != nil {
+		t.Fatal(err)
+	}
+	messages := <-received
+	if len(messages) != 2 {
+		t.Fatalf("expected 2 framed messages, got %d", len(messages))
+	}
+	if !strings.HasPrefix(messages[1], "<133>1 ") {
+		t.Errorf("expected a notice message, got %s", messages[1])
+	}
+}
+
+func readOctetCountedMessage(reader *bufio.Reader) (string, error) {
+	lengthField, err := reader.ReadString(' ')
+	if err != nil {
+		return "", err
+	}
+	length, err := strconv.Atoi(strings.TrimSpace(lengthField))
+	if err != nil {
+		return "", err
+	}
+	message := make([]byte, length)
+	_, err = io.ReadFull(reader, message)
+	return string(message), err
+}
+
+func TestLokiSink(t *testing.T) {
+	var pushRequest struct {
+		Streams []struct {
+			Stream map[string]string `json:"stream"`
+			Values [][2]string       `json:"values"`
+		} `json:"streams"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/loki/api/v1/push" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&pushRequest); err != nil {
+			t.Error(err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	sink := collector.NewLokiSink(server.URL+"/loki/api/v1/push", "192.168.0.1")
+	if err := sink.Ship(newTestRecords()); err != nil {
+		t.Fatal(err)
+	}
+	if len(pushRequest.Streams) != 2 {
+		t.Fatalf("expected 2 streams, got %d", len(pushRequest.Streams))
+	}
+	stream := pushRequest.Streams[0]
+	if stream.Stream["gateway"] != "192.168.0.1" || stream.Stream["severity"] != "critical" || stream.Stream["event_id"] != "82000200" {
+		t.Errorf("unexpected stream labels %v", stream.Stream)
+	}
+	if len(stream.Values) != 1 || !strings.Contains(stream.Values[0][1], "T3 time-out") {
+		t.Errorf("unexpected stream values %v", stream.Values)
+	}
+}
+
+// flakySink fails until it's told to accept records and hands over what it accepted
+type flakySink struct {
+	accept  chan bool
+	shipped chan []*collector.EventLogRecord
+}
+
+func (s *flakySink) Ship(records []*collector.EventLogRecord) error {
+	if !<-s.accept {
+		return io.ErrUnexpectedEOF
+	}
+	s.shipped <- records
+	return nil
+}
+
+func TestEventLogSinkRetries(t *testing.T) {
+	sink := &flakySink{accept: make(chan bool), shipped: make(chan []*collector.EventLogRecord, 1)}
+	eventLog := collector.NewEventLog()
+	eventLog.AddSink(sink)
+
+	// the log from before the exporter started isn't shipped again
+	entries := []*collector.EventLogEntry{{Time: "01/02/2024 10:00:00", Priority: "Critical (3)", Text: "No Ranging Response received - T3 time-out;CM-MAC=00:11:22:33:44:55;"}}
+	eventLog.Update(entries)
+	entries = append(entries, &collector.EventLogEntry{Time: "01/02/2024 10:05:00", Priority: "5", EventId: "84020200", Text: "Lost MDD Timeout"})
+	eventLog.Update(entries)
+	sink.accept <- false
+
+	// the next poll retries the records the sink failed to take
+	eventLog.Update(entries)
+	sink.accept <- true
+	select {
+	case records := <-sink.shipped:
+		if len(records) != 1 || records[0].EventId != "84020200" {
+			t.Errorf("expected only the lost MDD entry to be shipped, got %+v", records)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the records to be shipped after a retry")
+	}
+
+	eventLog.Update(entries)
+	select {
+	case sink.accept <- true:
+		t.Errorf("expected nothing left to ship")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,248 @@
+package collector
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"regexp"
+	"strings"
+)
+
+var (
+	channelHealthDesc   *prometheus.Desc
+	lineHealthScoreDesc *prometheus.Desc
+)
+
+func init() {
+	channelHealthDesc = newChannelDesc(prefix+"channel_health", "Health of a channel check: 0 = good, 1 = marginal, 2 = bad", []string{"direction", "channel_id", "check"})
+	lineHealthScoreDesc = prometheus.NewDesc(prefix+"line_health_score", "Overall line health from 0 (all checks bad) to 100 (all checks good)", nil, nil)
+}
+
+// Grade is the result of a health check
+type Grade int
+
+const (
+	Good Grade = iota
+	Marginal
+	Bad
+)
+
+func (g Grade) String() string {
+	switch g {
+	case Good:
+		return "good"
+	case Marginal:
+		return "marginal"
+	}
+	return "bad"
+}
+
+func (g Grade) MarshalText() ([]byte, error) {
+	return []byte(g.String()), nil
+}
+
+// Channel directions as used in metric names and labels
+const (
+	DirectionDownstream     = "downstream"
+	DirectionUpstream       = "upstream"
+	DirectionOfdmDownstream = "ofdm_downstream"
+	DirectionOfdmUpstream   = "ofdm_upstream"
+)
+
+// Health checks
+const (
+	CheckLock  = "lock"
+	CheckPower = "power"
+	CheckSnr   = "snr"
+)
+
+// Range is an inclusive range of values
+type Range struct {
+	Min float64 `yaml:"min"`
+	Max float64 `yaml:"max"`
+}
+
+func (r Range) contains(value float64) bool {
+	return value >= r.Min && value <= r.Max
+}
+
+// PowerThresholds grade a power level in dBmV. Levels outside of the marginal range are bad.
+type PowerThresholds struct {
+	Good     Range `yaml:"good"`
+	Marginal Range `yaml:"marginal"`
+}
+
+func (t PowerThresholds) grade(value float64) Grade {
+	switch {
+	case t.Good.contains(value):
+		return Good
+	case t.Marginal.contains(value):
+		return Marginal
+	}
+	return Bad
+}
+
+// SnrThresholds are the minimum SNR/MER in dB for a good and a marginal grade
+type SnrThresholds struct {
+	Good     float64 `yaml:"good"`
+	Marginal float64 `yaml:"marginal"`
+}
+
+func (t SnrThresholds) grade(value float64) Grade {
+	switch {
+	case value >= t.Good:
+		return Good
+	case value >= t.Marginal:
+		return Marginal
+	}
+	return Bad
+}
+
+// ThresholdProfile holds the acceptable signal ranges of an ISP. Downstream SNR thresholds are
+// keyed by modulation, e.g. "qam64", "qam256" or "ofdm".
+type ThresholdProfile struct {
+	DownstreamPower     PowerThresholds          `yaml:"downstream_power"`
+	DownstreamSnr       map[string]SnrThresholds `yaml:"downstream_snr"`
+	UpstreamPower       PowerThresholds          `yaml:"upstream_power"`
+	OfdmDownstreamPower PowerThresholds          `yaml:"ofdm_downstream_power"`
+	OfdmUpstreamPower   PowerThresholds          `yaml:"ofdm_upstream_power"`
+}
+
+// DefaultThresholdProfile returns the ranges commonly used for DOCSIS 3.0/3.1 plants
+func DefaultThresholdProfile() *ThresholdProfile {
+	return &ThresholdProfile{
+		DownstreamPower: PowerThresholds{Good: Range{-7, 7}, Marginal: Range{-10, 10}},
+		DownstreamSnr: map[string]SnrThresholds{
+			"qam64":  {Good: 27, Marginal: 24},
+			"qam256": {Good: 33, Marginal: 30},
+			"ofdm":   {Good: 38, Marginal: 34},
+		},
+		UpstreamPower:       PowerThresholds{Good: Range{35, 51}, Marginal: Range{32, 53}},
+		OfdmDownstreamPower: PowerThresholds{Good: Range{-7, 7}, Marginal: Range{-10, 10}},
+		OfdmUpstreamPower:   PowerThresholds{Good: Range{35, 48}, Marginal: Range{32, 51}},
+	}
+}
+
+// UnmarshalYAML starts from the default profile, so a profile only has to list what differs
+func (p *ThresholdProfile) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*p = *DefaultThresholdProfile()
+	type plain ThresholdProfile
+	return unmarshal((*plain)(p))
+}
+
+// ChannelHealth is the grade of a single check on a channel
+type ChannelHealth struct {
+	Direction string  `json:"direction"`
+	ChannelId string  `json:"channel_id"`
+	Check     string  `json:"check"`
+	Value     float64 `json:"value"`
+	Grade     Grade   `json:"grade"`
+}
+
+// LineHealth is the result of evaluating all channels of the line
+type LineHealth struct {
+	Channels []*ChannelHealth `json:"channels"`
+	Score    float64          `json:"score"`
+}
+
+// Overall returns the worst grade of all checks
+func (h *LineHealth) Overall() Grade {
+	overall := Good
+	for _, channel := range h.Channels {
+		if channel.Grade > overall {
+			overall = channel.Grade
+		}
+	}
+	return overall
+}
+
+// EvaluateHealth grades power and SNR of every channel against the profile
+func EvaluateHealth(data *ModemStatusData, profile *ThresholdProfile) *LineHealth {
+	if profile == nil {
+		profile = DefaultThresholdProfile()
+	}
+	health := &LineHealth{}
+	add := func(direction, channelId, check string, value float64, grade Grade) {
+		health.Channels = append(health.Channels, &ChannelHealth{direction, channelId, check, value, grade})
+	}
+	// unlocked channels report garbage levels, so only their lock status is graded
+	addLock := func(direction, channelId, lockStatus string) bool {
+		locked := lockStatus == "Locked"
+		grade := Good
+		if !locked {
+			grade = Bad
+		}
+		add(direction, channelId, CheckLock, bool2float64(locked), grade)
+		return locked
+	}
+
+	for _, channel := range data.Downstream {
+		if !addLock(DirectionDownstream, channel.ChannelId, channel.Locked) {
+			continue
+		}
+		power := parse2float(channel.Power)
+		add(DirectionDownstream, channel.ChannelId, CheckPower, power, profile.DownstreamPower.grade(power))
+		if thresholds, ok := profile.DownstreamSnr[modulationKey(channel.Modulation)]; ok {
+			snr := parse2float(channel.Snr)
+			add(DirectionDownstream, channel.ChannelId, CheckSnr, snr, thresholds.grade(snr))
+		}
+	}
+	for _, channel := range data.OfdmDownstreamData {
+		if !addLock(DirectionOfdmDownstream, channel.ChannelIdOfdm, channel.LockedOfdm) {
+			continue
+		}
+		power := parse2float(channel.PowerOfdm)
+		add(DirectionOfdmDownstream, channel.ChannelIdOfdm, CheckPower, power, profile.OfdmDownstreamPower.grade(power))
+		if thresholds, ok := profile.DownstreamSnr["ofdm"]; ok {
+			snr := parse2float(channel.SnrOfdm)
+			add(DirectionOfdmDownstream, channel.ChannelIdOfdm, CheckSnr, snr, thresholds.grade(snr))
+		}
+	}
+	for _, channel := range data.Upstream {
+		if !addLock(DirectionUpstream, channel.ChannelIdUp, channel.Locked) {
+			continue
+		}
+		power := parse2float(channel.Power)
+		add(DirectionUpstream, channel.ChannelIdUp, CheckPower, power, profile.UpstreamPower.grade(power))
+	}
+	for _, channel := range data.OfdmUpstreamData {
+		if !addLock(DirectionOfdmUpstream, channel.ChannelIdOfdm, channel.LockedOfdm) {
+			continue
+		}
+		power := parse2float(channel.PowerOfdm)
+		add(DirectionOfdmUpstream, channel.ChannelIdOfdm, CheckPower, power, profile.OfdmUpstreamPower.grade(power))
+	}
+
+	if len(health.Channels) > 0 {
+		points := 0.0
+		for _, channel := range health.Channels {
+			points += float64(Bad-channel.Grade) / float64(Bad)
+		}
+		health.Score = 100 * points / float64(len(health.Channels))
+	}
+	return health
+}
+
+var modulationRegex = regexp.MustCompile(`[0-9]+`)
+
+// modulationKey normalizes modulations like "256QAM", "QAM256" or "256-QAM" to "qam256"
+func modulationKey(modulation string) string {
+	if strings.Contains(strings.ToLower(modulation), "ofdm") {
+		return "ofdm"
+	}
+	order := modulationRegex.FindString(modulation)
+	if order == "" {
+		return "qam256"
+	}
+	return "qam" + order
+}
+
+func (c *Collector) collectHealth(ch chan<- prometheus.Metric, data *ModemStatusData, labelers map[string]*channelLabeler) {
+	health := EvaluateHealth(data, c.HealthProfile)
+	for _, channel := range health.Channels {
+		desc, channelLabel, ok := labelers[channel.Direction].derived(channelHealthDesc, channel.ChannelId)
+		if !ok {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, float64(channel.Grade), channel.Direction, channelLabel, channel.Check)
+	}
+	ch <- prometheus.MustNewConstMetric(lineHealthScoreDesc, prometheus.GaugeValue, health.Score)
+}
@@ -0,0 +1,72 @@
+package collector_test
+
+import (
+	"github.com/reynico/fibertel-station-exporter/collector"
+	"gopkg.in/yaml.v2"
+	"testing"
+)
+
+func newTestModemStatusData() *collector.ModemStatusData {
+	return &collector.ModemStatusData{
+		Downstream: []*collector.DocsisDownstreamChannel{
+			{Id: "1", ChannelId: "1", CentralFrequency: "603 MHz", Power: "2.5 dBmV", Snr: "38.6 dB", Modulation: "256QAM", Locked: "Locked"},
+			{Id: "2", ChannelId: "2", CentralFrequency: "609 MHz", Power: "-8.1 dBmV", Snr: "31.2 dB", Modulation: "256QAM", Locked: "Locked"},
+			{Id: "3", ChannelId: "3", CentralFrequency: "615 MHz", Power: "1.0 dBmV", Snr: "29.0 dB", Modulation: "64QAM", Locked: "Locked"},
+			{Id: "4", ChannelId: "4", CentralFrequency: "621 MHz", Power: "0 dBmV", Snr: "0 dB", Modulation: "256QAM", Locked: "Not Locked"},
+		},
+		OfdmDownstreamData: []*collector.OfdmDownstreamData{
+			{Id: "1", ChannelIdOfdm: "33", StartFrequency: "750 MHz", CentralFrequencyOfdm: "797 MHz", Bandwidth: "94 MHz", PowerOfdm: "1.2 dBmV", SnrOfdm: "40 dB", FftOfdm: "4K", LockedOfdm: "Locked"},
+		},
+		Upstream: []*collector.DocsisUpstreamChannel{
+			{Id: "1", ChannelIdUp: "1", CentralFrequency: "30.6 MHz", Power: "44.0 dBmV", SymbolRate: "5120", Locked: "Locked"},
+			{Id: "2", ChannelIdUp: "2", CentralFrequency: "37.0 MHz", Power: "52.5 dBmV", SymbolRate: "5120", Locked: "Locked"},
+		},
+	}
+}
+
+func TestEvaluateHealth(t *testing.T) {
+	health := collector.EvaluateHealth(newTestModemStatusData(), nil)
+	grades := make(map[string]collector.Grade)
+	for _, channel := range health.Channels {
+		grades[channel.Direction+"/"+channel.ChannelId+"/"+channel.Check] = channel.Grade
+	}
+	expected := map[string]collector.Grade{
+		"downstream/1/power":     collector.Good,
+		"downstream/1/snr":       collector.Good,
+		"downstream/2/power":     collector.Marginal,
+		"downstream/2/snr":       collector.Marginal,
+		"downstream/3/snr":       collector.Good,
+		"downstream/4/lock":      collector.Bad,
+		"ofdm_downstream/33/snr": collector.Good,
+		"upstream/1/power":       collector.Good,
+		"upstream/2/power":       collector.Marginal,
+	}
+	for key, grade := range expected {
+		if result, ok := grades[key]; !ok || result != grade {
+			t.Errorf("expected %s to be %s, got %s", key, grade, result)
+		}
+	}
+	if _, ok := grades["downstream/4/power"]; ok {
+		t.Errorf("unlocked channels should only be graded on their lock status")
+	}
+	if health.Overall() != collector.Bad {
+		t.Errorf("expected overall grade bad, got %s", health.Overall())
+	}
+	if health.Score <= 0 || health.Score >= 100 {
+		t.Errorf("expected a score between 0 and 100, got %v", health.Score)
+	}
+}
+
+func TestThresholdProfileDefaults(t *testing.T) {
+	profile := &collector.ThresholdProfile{}
+	err := yaml.Unmarshal([]byte("downstream_snr:\n  qam256: {good: 35, marginal: 32}\n"), profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profile.DownstreamSnr["qam256"].Good != 35 {
+		t.Errorf("expected the configured threshold to be used")
+	}
+	if profile.DownstreamSnr["qam64"].Good != 27 || profile.UpstreamPower.Good.Max != 51 {
+		t.Errorf("expected unset thresholds to keep their defaults")
+	}
+}
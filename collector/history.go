@@ -0,0 +1,294 @@
+package collector
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"github.com/prometheus/common/log"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultHistoryRetention = 7 * 24 * time.Hour
+	// DefaultHistoryMaxSize bounds the history file, about a week of snapshots polled every minute
+	DefaultHistoryMaxSize = 100 << 20
+	// expired snapshots are dropped from the file at most this often
+	historyCompactInterval = time.Hour
+	// longest line accepted when reading the history file
+	maxHistoryLineSize = 4 << 20
+)
+
+// HistoryRecord is a modem status snapshot as stored in the history file
+type HistoryRecord struct {
+	Time time.Time        `json:"time"`
+	Data *ModemStatusData `json:"data"`
+}
+
+// HistorySeries is the time series of a single channel
+type HistorySeries struct {
+	Direction string          `json:"direction"`
+	ChannelId string          `json:"channel_id"`
+	Points    []*HistoryPoint `json:"points"`
+}
+
+// HistoryPoint is the state of a channel at one point in time
+type HistoryPoint struct {
+	Time         time.Time `json:"time"`
+	FrequencyMHz float64   `json:"frequency_mhz"`
+	Power        float64   `json:"power"`
+	Snr          *float64  `json:"snr,omitempty"`
+	Locked       bool      `json:"locked"`
+}
+
+// HistoryStore keeps the modem status snapshots of the retention period in a file with one JSON
+// record per line. New snapshots are appended and expired ones are dropped by rewriting the
+// file, so it works like a ring buffer bounded by time and size. Only the file is kept, queries
+// read it.
+type HistoryStore struct {
+	path      string
+	retention time.Duration
+	maxSize   int64
+
+	mu          sync.Mutex
+	file        *os.File
+	size        int64
+	oldest      time.Time
+	lastCompact time.Time
+}
+
+// NewHistoryStore opens the history file at path, dropping the snapshots older than retention and
+// the oldest ones beyond maxSize bytes. A maxSize of 0 bounds the file by retention only.
+func NewHistoryStore(path string, retention time.Duration, maxSize int64) (*HistoryStore, error) {
+	store := &HistoryStore{path: path, retention: retention, maxSize: maxSize}
+	if err := store.compact(time.Now()); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// Append stores a snapshot
+func (s *HistoryStore) Append(now time.Time, data *ModemStatusData) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expired := !s.oldest.IsZero() && now.Sub(s.oldest) > s.retention && now.Sub(s.lastCompact) >= historyCompactInterval
+	if expired || (s.maxSize > 0 && s.size > s.maxSize) {
+		if err := s.compact(now); err != nil {
+			return err
+		}
+	}
+	line, err := json.Marshal(&HistoryRecord{Time: now, Data: data})
+	if err != nil {
+		return err
+	}
+	n, err := s.file.Write(append(line, '\n'))
+	s.size += int64(n)
+	if err != nil {
+		return err
+	}
+	if s.oldest.IsZero() {
+		s.oldest = now
+	}
+	return nil
+}
+
+// compact rewrites the history file without the expired snapshots and reopens it for appending.
+// Beyond the size limit the oldest snapshots are dropped too, down to three quarters of it so the
+// file isn't rewritten on every append. The file is read twice, once to find how much is kept and
+// once to copy it, so the snapshots never have to be held in memory.
+func (s *HistoryStore) compact(now time.Time) error {
+	if s.file != nil {
+		s.file.Close()
+		s.file = nil
+	}
+	expiry := now.Add(-s.retention)
+	var size int64
+	err := s.scanFile(func(record *HistoryRecord, line []byte) {
+		if !record.Time.Before(expiry) {
+			size += int64(len(line)) + 1
+		}
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	// the oldest snapshots are skipped until the rest fits
+	var skip int64
+	if s.maxSize > 0 && size > s.maxSize {
+		skip = size - s.maxSize*3/4
+	}
+
+	s.oldest = time.Time{}
+	size = 0
+	err = replaceFile(s.path, func(w io.Writer) error {
+		var writeErr error
+		err := s.scanFile(func(record *HistoryRecord, line []byte) {
+			if writeErr != nil || record.Time.Before(expiry) {
+				return
+			}
+			if skip > 0 {
+				skip -= int64(len(line)) + 1
+				return
+			}
+			if s.oldest.IsZero() || record.Time.Before(s.oldest) {
+				s.oldest = record.Time
+			}
+			if _, writeErr = w.Write(line); writeErr == nil {
+				_, writeErr = w.Write([]byte{'\n'})
+			}
+			size += int64(len(line)) + 1
+		})
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return writeErr
+	})
+	if err != nil {
+		return err
+	}
+	s.lastCompact = now
+	s.size = size
+	s.file, err = os.OpenFile(s.path, os.O_APPEND|os.O_WRONLY, 0644)
+	return err
+}
+
+// scanFile scans the history file, see scanHistory
+func (s *HistoryStore) scanFile(fn func(record *HistoryRecord, line []byte)) error {
+	file, err := os.Open(s.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return scanHistory(file, fn)
+}
+
+// scanHistory calls fn for every readable record of a history file. A line cut short by a crash
+// is skipped, it doesn't make the rest of the history unreadable.
+func scanHistory(r io.Reader, fn func(record *HistoryRecord, line []byte)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxHistoryLineSize)
+	for scanner.Scan() {
+		record := &HistoryRecord{}
+		if err := json.Unmarshal(scanner.Bytes(), record); err != nil || record.Data == nil {
+			log.Debugf("skipping unreadable history record: %s", scanner.Text())
+			continue
+		}
+		fn(record, scanner.Bytes())
+	}
+	return scanner.Err()
+}
+
+// Query returns the time series of every channel between from and to. channel selects a single
+// channel either by its id, e.g. "3", or by direction and id, e.g. "upstream/3". An empty channel
+// returns all of them.
+func (s *HistoryStore) Query(from, to time.Time, channel string) ([]*HistorySeries, error) {
+	// the file is opened and its size taken under the lock, so the scan neither blocks appends nor
+	// reads a half written snapshot. A compaction meanwhile replaces the file, the open one stays
+	// readable.
+	s.mu.Lock()
+	file, err := os.Open(s.path)
+	size := s.size
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	series := make(map[string]*HistorySeries)
+	add := func(direction, channelId string, point *HistoryPoint) {
+		if channel != "" && channel != channelId && channel != direction+"/"+channelId {
+			return
+		}
+		key := direction + "/" + channelId
+		if series[key] == nil {
+			series[key] = &HistorySeries{Direction: direction, ChannelId: channelId}
+		}
+		series[key].Points = append(series[key].Points, point)
+	}
+	snr := func(str string) *float64 {
+		value := parse2float(str)
+		return &value
+	}
+
+	err = scanHistory(io.LimitReader(file, size), func(record *HistoryRecord, line []byte) {
+		if record.Time.Before(from) || (!to.IsZero() && record.Time.After(to)) {
+			return
+		}
+		data := record.Data
+		for _, channel := range data.Downstream {
+			add(DirectionDownstream, channel.ChannelId, &HistoryPoint{record.Time, parseFrequencyMHz(channel.CentralFrequency), parse2float(channel.Power), snr(channel.Snr), channel.Locked == "Locked"})
+		}
+		for _, channel := range data.OfdmDownstreamData {
+			add(DirectionOfdmDownstream, channel.ChannelIdOfdm, &HistoryPoint{record.Time, parseFrequencyMHz(channel.CentralFrequencyOfdm), parse2float(channel.PowerOfdm), snr(channel.SnrOfdm), channel.LockedOfdm == "Locked"})
+		}
+		for _, channel := range data.Upstream {
+			add(DirectionUpstream, channel.ChannelIdUp, &HistoryPoint{record.Time, parseFrequencyMHz(channel.CentralFrequency), parse2float(channel.Power), nil, channel.Locked == "Locked"})
+		}
+		for _, channel := range data.OfdmUpstreamData {
+			add(DirectionOfdmUpstream, channel.ChannelIdOfdm, &HistoryPoint{record.Time, parseFrequencyMHz(channel.CentralFrequencyOfdm), parse2float(channel.PowerOfdm), nil, channel.LockedOfdm == "Locked"})
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*HistorySeries, 0, len(series))
+	for _, channelSeries := range series {
+		result = append(result, channelSeries)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Direction != result[j].Direction {
+			return result[i].Direction < result[j].Direction
+		}
+		return channelIdLess(result[i].ChannelId, result[j].ChannelId)
+	})
+	return result, nil
+}
+
+// channelIdLess sorts numeric channel ids by value
+func channelIdLess(a, b string) bool {
+	numberA, errA := strconv.Atoi(a)
+	numberB, errB := strconv.Atoi(b)
+	if errA == nil && errB == nil {
+		return numberA < numberB
+	}
+	return a < b
+}
+
+// WriteHistoryCSV writes the series with one row per channel and point in time
+func WriteHistoryCSV(w io.Writer, series []*HistorySeries) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"time", "direction", "channel_id", "frequency_mhz", "power", "snr", "locked"})
+	for _, channelSeries := range series {
+		for _, point := range channelSeries.Points {
+			snr := ""
+			if point.Snr != nil {
+				snr = strconv.FormatFloat(*point.Snr, 'f', -1, 64)
+			}
+			writer.Write([]string{
+				point.Time.Format(time.RFC3339),
+				channelSeries.Direction,
+				channelSeries.ChannelId,
+				strconv.FormatFloat(point.FrequencyMHz, 'f', -1, 64),
+				strconv.FormatFloat(point.Power, 'f', -1, 64),
+				snr,
+				strconv.FormatBool(point.Locked),
+			})
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func (c *Collector) recordHistory(data *ModemStatusData) {
+	if c.History == nil {
+		return
+	}
+	if err := c.History.Append(time.Now(), data); err != nil {
+		log.Errorf("error storing modem status history: %s", err.Error())
+	}
+}
@@ -0,0 +1,111 @@
+package collector_test
+
+import (
+	"bytes"
+	"github.com/reynico/fibertel-station-exporter/collector"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHistoryStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	store, err := collector.NewHistoryStore(path, 24*time.Hour, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now().Add(-30 * time.Hour)
+	for i, snr := range []string{"38.6 dB", "37.9 dB", "36.2 dB"} {
+		data := newTestModemStatusData()
+		data.Downstream[0].Snr = snr
+		if err := store.Append(start.Add(time.Duration(i)*10*time.Hour), data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	series, err := store.Query(time.Time{}, time.Time{}, "downstream/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(series) != 1 || len(series[0].Points) != 3 {
+		t.Fatalf("expected 3 points of downstream channel 1, got %+v", series)
+	}
+	if point := series[0].Points[2]; *point.Snr != 36.2 || point.FrequencyMHz != 603 || !point.Locked {
+		t.Errorf("unexpected point %+v", point)
+	}
+	if series, _ := store.Query(time.Time{}, time.Time{}, "1"); len(series) != 2 {
+		t.Errorf("expected downstream and upstream channel 1, got %d series", len(series))
+	}
+	if series, _ := store.Query(start.Add(5*time.Hour), start.Add(15*time.Hour), "downstream/1"); len(series) != 1 || len(series[0].Points) != 1 {
+		t.Errorf("expected a single point in the time range, got %+v", series)
+	}
+
+	// a record cut short by a crash doesn't spoil the rest of the file
+	file, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	file.WriteString(`{"time":"2021-03-01T00:00:00Z","data":{"DSTbl":[`)
+	file.Close()
+
+	// reopening drops the snapshot that is older than the retention
+	store, err = collector.NewHistoryStore(path, 24*time.Hour, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	series, err = store.Query(time.Time{}, time.Time{}, "downstream/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(series) != 1 || len(series[0].Points) != 2 {
+		t.Fatalf("expected 2 points within the retention, got %+v", series)
+	}
+
+	var csv bytes.Buffer
+	if err := collector.WriteHistoryCSV(&csv, series); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(csv.String()), "\n"); len(lines) != 3 || !strings.HasSuffix(lines[2], ",downstream,1,603,2.5,36.2,true") {
+		t.Errorf("unexpected CSV %q", csv.String())
+	}
+}
+
+func TestHistoryStoreMaxSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	store, err := collector.NewHistoryStore(path, 24*time.Hour, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	if err := store.Append(now, newTestModemStatusData()); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recordSize := info.Size()
+
+	// room for 4 snapshots, beyond that the oldest are dropped down to 3
+	store, err = collector.NewHistoryStore(path, 24*time.Hour, 4*recordSize+recordSize/2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i < 6; i++ {
+		if err := store.Append(now.Add(time.Duration(i)*time.Minute), newTestModemStatusData()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	series, err := store.Query(time.Time{}, time.Time{}, "downstream/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(series) != 1 || len(series[0].Points) != 4 {
+		t.Fatalf("expected 4 points, got %+v", series)
+	}
+	if first := series[0].Points[0].Time; !first.Equal(now.Add(2 * time.Minute)) {
+		t.Errorf("expected the oldest snapshots to be dropped, the first point is at %s", first)
+	}
+	if info, _ := os.Stat(path); info.Size() > 4*recordSize+recordSize/2 {
+		t.Errorf("expected the file to stay below the limit, got %d bytes", info.Size())
+	}
+}
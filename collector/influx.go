@@ -0,0 +1,245 @@
+package collector
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/log"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// InfluxConfig configures pushing the metrics to InfluxDB. Database selects the v1 /write
+// endpoint, Bucket the v2 /api/v2/write endpoint.
+type InfluxConfig struct {
+	// URL of the InfluxDB server, e.g. http://influxdb:8086
+	URL             string `yaml:"url"`
+	Database        string `yaml:"database"`
+	RetentionPolicy string `yaml:"retention_policy"`
+	Username        string `yaml:"username"`
+	Password        string `yaml:"password"`
+	Org             string `yaml:"org"`
+	Bucket          string `yaml:"bucket"`
+	Token           string `yaml:"token"`
+	// Tags are added to every line, e.g. to tell several gateways apart
+	Tags map[string]string `yaml:"tags"`
+	// BatchSize is the maximum number of lines per request
+	BatchSize int  `yaml:"batch_size"`
+	Gzip      bool `yaml:"gzip"`
+	// Retries is how often a failed request is retried, waiting RetryBackoff doubling on every retry
+	Retries      int           `yaml:"retries"`
+	RetryBackoff time.Duration `yaml:"retry_backoff"`
+}
+
+// DefaultInfluxConfig returns the settings used for everything the configuration doesn't set
+func DefaultInfluxConfig() *InfluxConfig {
+	return &InfluxConfig{
+		BatchSize:    5000,
+		Gzip:         true,
+		Retries:      3,
+		RetryBackoff: 5 * time.Second,
+	}
+}
+
+// Pusher sends the metrics of a poll somewhere, e.g. to InfluxDB
+type Pusher interface {
+	Push(families []*dto.MetricFamily, now time.Time) error
+}
+
+var (
+	influxMeasurementEscaper = strings.NewReplacer(`,`, `\,`, ` `, `\ `)
+	influxTagEscaper         = strings.NewReplacer(`,`, `\,`, `=`, `\=`, ` `, `\ `)
+)
+
+// WriteLineProtocol writes the metrics as InfluxDB line protocol, one line per series with the
+// metric name as measurement, the labels and tags as tags and a single value field. Metrics
+// without a timestamp get now.
+func WriteLineProtocol(w io.Writer, families []*dto.MetricFamily, tags map[string]string, now time.Time) error {
+	writer := bufio.NewWriter(w)
+	for _, line := range lineProtocol(families, tags, now) {
+		writer.WriteString(line)
+		writer.WriteByte('\n')
+	}
+	return writer.Flush()
+}
+
+func lineProtocol(families []*dto.MetricFamily, tags map[string]string, now time.Time) []string {
+	var lines []string
+	for _, family := range families {
+		for _, metric := range family.Metric {
+			var value float64
+			switch {
+			case metric.Gauge != nil:
+				value = metric.Gauge.GetValue()
+			case metric.Counter != nil:
+				value = metric.Counter.GetValue()
+			case metric.Untyped != nil:
+				value = metric.Untyped.GetValue()
+			default:
+				continue
+			}
+			// line protocol can't represent these
+			if math.IsNaN(value) || math.IsInf(value, 0) {
+				continue
+			}
+
+			metricTags := make(map[string]string, len(metric.Label)+len(tags))
+			for name, tag := range tags {
+				metricTags[name] = tag
+			}
+			for _, label := range metric.Label {
+				metricTags[label.GetName()] = label.GetValue()
+			}
+			names := make([]string, 0, len(metricTags))
+			for name, tag := range metricTags {
+				// empty tag values aren't allowed
+				if tag != "" {
+					names = append(names, name)
+				}
+			}
+			sort.Strings(names)
+
+			var line strings.Builder
+			line.WriteString(influxMeasurementEscaper.Replace(family.GetName()))
+			for _, name := range names {
+				line.WriteString("," + influxTagEscaper.Replace(name) + "=" + influxTagEscaper.Replace(metricTags[name]))
+			}
+			line.WriteString(" value=" + strconv.FormatFloat(value, 'g', -1, 64) + " ")
+			timestamp := now.UnixNano()
+			if metric.TimestampMs != nil {
+				timestamp = metric.GetTimestampMs() * int64(time.Millisecond)
+			}
+			line.WriteString(strconv.FormatInt(timestamp, 10))
+			lines = append(lines, line.String())
+		}
+	}
+	return lines
+}
+
+// InfluxWriter pushes the metrics of every poll to InfluxDB in batches
+type InfluxWriter struct {
+	config *InfluxConfig
+	url    string
+	client *http.Client
+}
+
+func NewInfluxWriter(config *InfluxConfig) (*InfluxWriter, error) {
+	base, err := url.Parse(config.URL)
+	if err != nil {
+		return nil, err
+	}
+	query := url.Values{}
+	switch {
+	case config.Bucket != "":
+		base.Path = strings.TrimSuffix(base.Path, "/") + "/api/v2/write"
+		query.Set("org", config.Org)
+		query.Set("bucket", config.Bucket)
+	case config.Database != "":
+		base.Path = strings.TrimSuffix(base.Path, "/") + "/write"
+		query.Set("db", config.Database)
+		if config.RetentionPolicy != "" {
+			query.Set("rp", config.RetentionPolicy)
+		}
+	default:
+		return nil, fmt.Errorf("influxdb needs a database (v1) or a bucket (v2)")
+	}
+	query.Set("precision", "ns")
+	base.RawQuery = query.Encode()
+	if config.BatchSize <= 0 {
+		config.BatchSize = DefaultInfluxConfig().BatchSize
+	}
+	return &InfluxWriter{
+		config: config,
+		url:    base.String(),
+		client: &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// Push writes the metrics in batches of at most BatchSize lines
+func (w *InfluxWriter) Push(families []*dto.MetricFamily, now time.Time) error {
+	lines := lineProtocol(families, w.config.Tags, now)
+	for start := 0; start < len(lines); start += w.config.BatchSize {
+		end := start + w.config.BatchSize
+		if end > len(lines) {
+			end = len(lines)
+		}
+		if err := w.writeWithRetries(strings.Join(lines[start:end], "\n") + "\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *InfluxWriter) writeWithRetries(batch string) error {
+	backoff := w.config.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		err := w.write(batch)
+		if err == nil || attempt >= w.config.Retries {
+			return err
+		}
+		if _, ok := err.(*influxClientError); ok {
+			// the batch won't get better by sending it again
+			return err
+		}
+		log.Warnf("error writing to influxdb, retrying in %s: %s", backoff, err.Error())
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// influxClientError is a 4xx response, e.g. a parse error or missing permissions
+type influxClientError struct {
+	status  string
+	message string
+}
+
+func (e *influxClientError) Error() string {
+	return fmt.Sprintf("influxdb responded %s: %s", e.status, e.message)
+}
+
+func (w *InfluxWriter) write(batch string) error {
+	var body bytes.Buffer
+	if w.config.Gzip {
+		compressor := gzip.NewWriter(&body)
+		compressor.Write([]byte(batch))
+		compressor.Close()
+	} else {
+		body.WriteString(batch)
+	}
+	request, err := http.NewRequest(http.MethodPost, w.url, &body)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if w.config.Gzip {
+		request.Header.Set("Content-Encoding", "gzip")
+	}
+	switch {
+	case w.config.Token != "":
+		request.Header.Set("Authorization", "Token "+w.config.Token)
+	case w.config.Username != "":
+		request.SetBasicAuth(w.config.Username, w.config.Password)
+	}
+	response, err := w.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	message, _ := io.ReadAll(io.LimitReader(response.Body, 1024))
+	switch {
+	case response.StatusCode >= 200 && response.StatusCode < 300:
+		return nil
+	// 429 asks to back off, which is what the retry does
+	case response.StatusCode >= 400 && response.StatusCode < 500 && response.StatusCode != http.StatusTooManyRequests:
+		return &influxClientError{response.Status, strings.TrimSpace(string(message))}
+	}
+	return fmt.Errorf("influxdb responded %s: %s", response.Status, strings.TrimSpace(string(message)))
+}
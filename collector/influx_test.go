@@ -0,0 +1,127 @@
+package collector_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/reynico/fibertel-station-exporter/collector"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func gatherTestStation(t *testing.T) *prometheus.Registry {
+	station := newTestStation(t, newTestModemStatusData())
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(&collector.Collector{Station: collector.NewFibertelStation(station.URL, "custadmin", "password")})
+	return registry
+}
+
+func TestWriteLineProtocol(t *testing.T) {
+	families, err := gatherTestStation(t).Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	now := time.Unix(1614556800, 0)
+	if err := collector.WriteLineProtocol(&buf, families, map[string]string{"site": "home office"}, now); err != nil {
+		t.Fatal(err)
+	}
+	lines := buf.String()
+	for _, expected := range []string{
+		"fibertel_downstream_snr_dB,channel_id=2,fft=256QAM,id=2,site=home\\ office value=31.2 1614556800000000000\n",
+		"fibertel_login_success_bool,site=home\\ office value=1 1614556800000000000\n",
+	} {
+		if !strings.Contains(lines, expected) {
+			t.Errorf("expected %q in the line protocol, got:\n%s", expected, lines)
+		}
+	}
+}
+
+func TestInfluxWriter(t *testing.T) {
+	type request struct {
+		path, query, auth string
+		lines             []string
+	}
+	requests := make(chan *request, 10)
+	attempts := 0
+	influx := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		// the first attempt fails to exercise the retry
+		if attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if r.Header.Get("Content-Encoding") != "gzip" {
+			t.Errorf("expected a gzipped body")
+		}
+		reader, err := gzip.NewReader(r.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(reader)
+		requests <- &request{r.URL.Path, r.URL.RawQuery, r.Header.Get("Authorization"), strings.Split(strings.TrimSpace(string(body)), "\n")}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer influx.Close()
+
+	families, err := gatherTestStation(t).Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := collector.DefaultInfluxConfig()
+	config.URL = influx.URL
+	config.Org = "home"
+	config.Bucket = "fibertel"
+	config.Token = "s3cret"
+	config.BatchSize = 50
+	config.RetryBackoff = 10 * time.Millisecond
+	writer, err := collector.NewInfluxWriter(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Push(families, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	close(requests)
+	batches, lines := 0, 0
+	for request := range requests {
+		batches++
+		lines += len(request.lines)
+		if request.path != "/api/v2/write" || request.query != "bucket=fibertel&org=home&precision=ns" || request.auth != "Token s3cret" {
+			t.Errorf("unexpected v2 request %+v", request)
+		}
+		if len(request.lines) > 50 {
+			t.Errorf("expected at most 50 lines per batch, got %d", len(request.lines))
+		}
+	}
+	if batches < 2 || lines < 60 {
+		t.Errorf("expected the metrics in several batches, got %d lines in %d batches", lines, batches)
+	}
+
+	// v1 with a client error, which isn't retried
+	attempts = 0
+	rejecting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if r.URL.Path != "/write" || r.URL.Query().Get("db") != "fibertel" {
+			t.Errorf("unexpected v1 request %s", r.URL)
+		}
+		http.Error(w, `{"error":"database not found"}`, http.StatusNotFound)
+	}))
+	defer rejecting.Close()
+	config = collector.DefaultInfluxConfig()
+	config.URL = rejecting.URL
+	config.Database = "fibertel"
+	config.RetryBackoff = 10 * time.Millisecond
+	writer, err = collector.NewInfluxWriter(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Push(families, time.Now()); err == nil || !strings.Contains(err.Error(), "database not found") || attempts != 1 {
+		t.Errorf("expected the client error without retries, got %v after %d attempts", err, attempts)
+	}
+}
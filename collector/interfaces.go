@@ -0,0 +1,97 @@
+package collector
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+	"math"
+)
+
+var (
+	interfaceReceiveBytesDesc    *prometheus.Desc
+	interfaceTransmitBytesDesc   *prometheus.Desc
+	interfaceReceivePacketsDesc  *prometheus.Desc
+	interfaceTransmitPacketsDesc *prometheus.Desc
+)
+
+func init() {
+	interfaceLabels := []string{"interface"}
+	interfaceReceiveBytesDesc = prometheus.NewDesc(prefix+"interface_receive_bytes_total", "Bytes received on the interface", interfaceLabels, nil)
+	interfaceTransmitBytesDesc = prometheus.NewDesc(prefix+"interface_transmit_bytes_total", "Bytes transmitted on the interface", interfaceLabels, nil)
+	interfaceReceivePacketsDesc = prometheus.NewDesc(prefix+"interface_receive_packets_total", "Packets received on the interface", interfaceLabels, nil)
+	interfaceTransmitPacketsDesc = prometheus.NewDesc(prefix+"interface_transmit_packets_total", "Packets transmitted on the interface", interfaceLabels, nil)
+}
+
+func describeInterfaceStats(ch chan<- *prometheus.Desc) {
+	ch <- interfaceReceiveBytesDesc
+	ch <- interfaceTransmitBytesDesc
+	ch <- interfaceReceivePacketsDesc
+	ch <- interfaceTransmitPacketsDesc
+}
+
+func (c *Collector) collectInterfaceStats(ch chan<- prometheus.Metric) {
+	interfaceStatsResponse, err := c.Station.GetInterfaceStats()
+	switch {
+	case err != nil && !c.interfaceStatsLogged:
+		log.Warnf("error getting interface stats, the firmware might not support it: %s", err.Error())
+		c.interfaceStatsLogged = true
+		return
+	case err != nil:
+		log.Debugf("error getting interface stats: %s", err.Error())
+		return
+	}
+	if interfaceStatsResponse.Data == nil {
+		return
+	}
+	for _, stats := range interfaceStatsResponse.Data.Interfaces {
+		counters := []struct {
+			name  string
+			desc  *prometheus.Desc
+			value string
+		}{
+			{"receive_bytes", interfaceReceiveBytesDesc, stats.BytesReceived},
+			{"transmit_bytes", interfaceTransmitBytesDesc, stats.BytesSent},
+			{"receive_packets", interfaceReceivePacketsDesc, stats.PacketsReceived},
+			{"transmit_packets", interfaceTransmitPacketsDesc, stats.PacketsSent},
+		}
+		for _, counter := range counters {
+			value := c.counters.update(stats.Name+"/"+counter.name, parse2float(counter.value))
+			ch <- prometheus.MustNewConstMetric(counter.desc, prometheus.CounterValue, value, stats.Name)
+		}
+	}
+}
+
+const maxUint32 = float64(math.MaxUint32)
+
+// counterTracker turns the raw counters reported by the gateway into counters
+// that never go backwards. Some gateway counters are only 32 bits wide and all
+// of them start over at zero after a reboot.
+type counterTracker struct {
+	series map[string]*trackedCounter
+}
+
+type trackedCounter struct {
+	last   float64
+	offset float64
+}
+
+func (t *counterTracker) update(key string, raw float64) float64 {
+	if t.series == nil {
+		t.series = make(map[string]*trackedCounter)
+	}
+	counter, ok := t.series[key]
+	if !ok {
+		t.series[key] = &trackedCounter{last: raw}
+		return raw
+	}
+	if raw < counter.last {
+		if counter.last > maxUint32*0.9 && raw < maxUint32*0.1 {
+			// a 32 bit counter wrapped around
+			counter.offset += maxUint32 + 1
+		} else {
+			// the gateway rebooted and started counting from zero
+			counter.offset += counter.last
+		}
+	}
+	counter.last = raw
+	return counter.offset + raw
+}
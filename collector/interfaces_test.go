@@ -0,0 +1,24 @@
+package collector
+
+import (
+	"testing"
+)
+
+func TestCounterTrackerReboot(t *testing.T) {
+	tracker := &counterTracker{}
+	values := []float64{100, 250, 30, 80}
+	expected := []float64{100, 250, 280, 330}
+	for i, value := range values {
+		if result := tracker.update("wan0/receive_bytes", value); result != expected[i] {
+			t.Errorf("update(%v) = %v, expected %v", value, result, expected[i])
+		}
+	}
+}
+
+func TestCounterTrackerWrap(t *testing.T) {
+	tracker := &counterTracker{}
+	tracker.update("wan0/receive_bytes", maxUint32-10)
+	if result := tracker.update("wan0/receive_bytes", 5); result != maxUint32+6 {
+		t.Errorf("32 bit wrap not handled, got %v", result)
+	}
+}
@@ -0,0 +1,140 @@
+package collector
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+	"math"
+	"strconv"
+)
+
+var (
+	// channelDescs are all per channel descriptors, in the order they were created
+	channelDescs []*prometheus.Desc
+	// frequencyKeyedDescs maps the per channel descriptors to their counterpart labelled by frequency
+	frequencyKeyedDescs = make(map[*prometheus.Desc]*prometheus.Desc)
+	// gatewayChannelLabels move to the channel info metrics in frequency mode
+	gatewayChannelLabels = map[string]bool{"id": true, "channel_id": true, "channel_id_up": true, "channel_id_ofdm": true, "fft": true, "channel_type": true}
+
+	downstreamChannelInfoDesc     *prometheus.Desc
+	ofdmDownstreamChannelInfoDesc *prometheus.Desc
+	upstreamChannelInfoDesc       *prometheus.Desc
+	ofdmUpstreamChannelInfoDesc   *prometheus.Desc
+)
+
+func init() {
+	downstreamChannelInfoDesc = prometheus.NewDesc(prefix+"downstream_channel_info", "Gateway ids of the downstream channel on this frequency", []string{"frequency_mhz", "id", "channel_id", "fft", "channel_type"}, nil)
+	ofdmDownstreamChannelInfoDesc = prometheus.NewDesc(prefix+"ofdm_downstream_channel_info", "Gateway ids of the OFDM downstream channel on this frequency", []string{"frequency_mhz", "id", "channel_id_ofdm", "fft", "channel_type"}, nil)
+	upstreamChannelInfoDesc = prometheus.NewDesc(prefix+"upstream_channel_info", "Gateway ids of the upstream channel on this frequency", []string{"frequency_mhz", "id", "channel_id_up", "fft", "channel_type"}, nil)
+	ofdmUpstreamChannelInfoDesc = prometheus.NewDesc(prefix+"ofdm_upstream_channel_info", "Gateway ids of the OFDM upstream channel on this frequency", []string{"frequency_mhz", "id", "channel_id_ofdm", "fft", "channel_type"}, nil)
+}
+
+// newChannelDesc creates a per channel descriptor labelled with the gateway ids, along with its
+// counterpart labelled by frequency. Other labels, e.g. the direction, are kept by both.
+func newChannelDesc(name, help string, labels []string) *prometheus.Desc {
+	desc := prometheus.NewDesc(name, help, labels, nil)
+	channelDescs = append(channelDescs, desc)
+	var frequencyLabels []string
+	for _, label := range labels {
+		switch {
+		case !gatewayChannelLabels[label]:
+			frequencyLabels = append(frequencyLabels, label)
+		case !contains(frequencyLabels, "frequency_mhz"):
+			frequencyLabels = append(frequencyLabels, "frequency_mhz")
+		}
+	}
+	frequencyKeyedDescs[desc] = prometheus.NewDesc(name, help, frequencyLabels, nil)
+	return desc
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Collector) describeChannels(ch chan<- *prometheus.Desc) {
+	for _, desc := range channelDescs {
+		if c.FrequencyLabels {
+			desc = frequencyKeyedDescs[desc]
+		}
+		ch <- desc
+	}
+	if c.FrequencyLabels {
+		ch <- downstreamChannelInfoDesc
+		ch <- ofdmDownstreamChannelInfoDesc
+		ch <- upstreamChannelInfoDesc
+		ch <- ofdmUpstreamChannelInfoDesc
+	}
+}
+
+// channelLabeler labels the metrics of the channels of one direction. The gateway reshuffles
+// __id and ChannelID after re-ranging, so in frequency mode the series are keyed by the
+// normalized centre frequency and the ids are moved to an info metric.
+type channelLabeler struct {
+	ch             chan<- prometheus.Metric
+	frequencyKeyed bool
+	infoDesc       *prometheus.Desc
+	seen           map[string]bool
+	// frequencies are the frequency labels of the labelled channels by channel id
+	frequencies map[string]string
+}
+
+// channelMetrics sends the metrics of a single channel
+type channelMetrics struct {
+	ch             chan<- prometheus.Metric
+	frequencyKeyed bool
+	labels         []string
+}
+
+func (c *Collector) newChannelLabeler(ch chan<- prometheus.Metric, infoDesc *prometheus.Desc) *channelLabeler {
+	return &channelLabeler{
+		ch:             ch,
+		frequencyKeyed: c.FrequencyLabels,
+		infoDesc:       infoDesc,
+		seen:           make(map[string]bool),
+		frequencies:    make(map[string]string),
+	}
+}
+
+// channel returns the metrics of the channel, or nil if another channel of the direction
+// already uses the same frequency. labels are the gateway labels, starting with id and channel id.
+func (l *channelLabeler) channel(frequency string, labels ...string) *channelMetrics {
+	if !l.frequencyKeyed {
+		return &channelMetrics{ch: l.ch, labels: labels}
+	}
+	frequencyMHz := normalizeFrequencyLabel(frequency)
+	if l.seen[frequencyMHz] {
+		log.Debugf("skipping channel %v, another channel is on %s MHz", labels, frequencyMHz)
+		return nil
+	}
+	l.seen[frequencyMHz] = true
+	l.frequencies[labels[1]] = frequencyMHz
+	l.ch <- prometheus.MustNewConstMetric(l.infoDesc, prometheus.GaugeValue, 1, append([]string{frequencyMHz}, labels...)...)
+	return &channelMetrics{ch: l.ch, frequencyKeyed: true, labels: []string{frequencyMHz}}
+}
+
+// derived returns the descriptor and channel label of a metric derived from a channel the labeler
+// labelled, e.g. its health: the channel id, or in frequency mode its frequency. ok is false for
+// channels the labeler skipped.
+func (l *channelLabeler) derived(desc *prometheus.Desc, channelId string) (*prometheus.Desc, string, bool) {
+	if !l.frequencyKeyed {
+		return desc, channelId, true
+	}
+	frequencyMHz, ok := l.frequencies[channelId]
+	return frequencyKeyedDescs[desc], frequencyMHz, ok
+}
+
+func (m *channelMetrics) gauge(desc *prometheus.Desc, value float64) {
+	if m.frequencyKeyed {
+		desc = frequencyKeyedDescs[desc]
+	}
+	m.ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value, m.labels...)
+}
+
+// normalizeFrequencyLabel formats a frequency in MHz rounded to 100 kHz, e.g. "603" or "30.6"
+func normalizeFrequencyLabel(frequency string) string {
+	return strconv.FormatFloat(math.Round(parseFrequencyMHz(frequency)*10)/10, 'f', -1, 64)
+}
@@ -0,0 +1,66 @@
+package collector
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+	"strings"
+)
+
+var (
+	lanPortUpDesc         *prometheus.Desc
+	lanPortSpeedDesc      *prometheus.Desc
+	lanPortFullDuplexDesc *prometheus.Desc
+)
+
+func init() {
+	lanPortLabels := []string{"port"}
+	lanPortUpDesc = prometheus.NewDesc(prefix+"lan_port_up", "1 if the LAN port has a link", lanPortLabels, nil)
+	lanPortSpeedDesc = prometheus.NewDesc(prefix+"lan_port_speed_bps", "Negotiated link speed in bits per second", lanPortLabels, nil)
+	lanPortFullDuplexDesc = prometheus.NewDesc(prefix+"lan_port_full_duplex_bool", "1 if the link negotiated full duplex", lanPortLabels, nil)
+}
+
+func describeLanPorts(ch chan<- *prometheus.Desc) {
+	ch <- lanPortUpDesc
+	ch <- lanPortSpeedDesc
+	ch <- lanPortFullDuplexDesc
+}
+
+func (c *Collector) collectLanPorts(ch chan<- prometheus.Metric) {
+	lanPortStatusResponse, err := c.Station.GetLanPortStatus()
+	switch {
+	case err != nil && !c.lanPortsLogged:
+		log.Warnf("error getting LAN port status, the firmware might not support it: %s", err.Error())
+		c.lanPortsLogged = true
+		return
+	case err != nil:
+		log.Debugf("error getting LAN port status: %s", err.Error())
+		return
+	}
+	if lanPortStatusResponse.Data == nil {
+		return
+	}
+	for _, port := range lanPortStatusResponse.Data.Ports {
+		up := strings.EqualFold(port.LinkStatus, "Up")
+		speed := 0.0
+		if up {
+			speed = parseLinkSpeed(port.Speed)
+		}
+		ch <- prometheus.MustNewConstMetric(lanPortUpDesc, prometheus.GaugeValue, bool2float64(up), port.Port)
+		ch <- prometheus.MustNewConstMetric(lanPortSpeedDesc, prometheus.GaugeValue, speed, port.Port)
+		ch <- prometheus.MustNewConstMetric(lanPortFullDuplexDesc, prometheus.GaugeValue, bool2float64(up && strings.EqualFold(port.Duplex, "Full")), port.Port)
+	}
+}
+
+// parseLinkSpeed converts speeds like "1000", "100 Mbps" or "2.5G" to bits per second.
+// Plain numbers are Mbps, which is what the gateway web interface shows.
+func parseLinkSpeed(str string) float64 {
+	value := parse2float(str)
+	switch {
+	case strings.Contains(strings.ToUpper(str), "G"):
+		return value * 1e9
+	case value >= 1e5:
+		return value
+	default:
+		return value * 1e6
+	}
+}
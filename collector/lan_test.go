@@ -0,0 +1,21 @@
+package collector
+
+import (
+	"testing"
+)
+
+func TestParseLinkSpeed(t *testing.T) {
+	speeds := map[string]float64{
+		"1000":       1e9,
+		"100 Mbps":   1e8,
+		"10M":        1e7,
+		"2.5G":       2.5e9,
+		"1000000000": 1e9,
+		"":           0,
+	}
+	for str, expected := range speeds {
+		if result := parseLinkSpeed(str); result != expected {
+			t.Errorf("parseLinkSpeed(%q) = %v, expected %v", str, result, expected)
+		}
+	}
+}
@@ -0,0 +1,537 @@
+package collector
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"github.com/prometheus/common/log"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MQTT 3.1.1 control packet types, shifted into the upper nibble of the fixed header
+const (
+	mqttConnect = 1 << 4
+	mqttConnack = 2 << 4
+	mqttPublish = 3 << 4
+	mqttPingreq = 12 << 4
+)
+
+const (
+	mqttOnline  = "online"
+	mqttOffline = "offline"
+)
+
+// MQTTConfig configures publishing the modem status to an MQTT broker
+type MQTTConfig struct {
+	// Broker is the address of the broker, tcp://host:1883 or tls://host:8883
+	Broker   string `yaml:"broker"`
+	ClientId string `yaml:"client_id"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	// CAFile is a PEM file with the certificates a TLS broker is verified against instead of the system ones
+	CAFile             string `yaml:"ca_file"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+	// TopicPrefix is prepended to the state topics, e.g. fibertel/downstream/603
+	TopicPrefix string `yaml:"topic_prefix"`
+	// Retain makes the broker keep the last state messages for new subscribers
+	Retain bool `yaml:"retain"`
+	// Discovery publishes Home Assistant MQTT discovery configs below DiscoveryPrefix
+	Discovery       bool   `yaml:"discovery"`
+	DiscoveryPrefix string `yaml:"discovery_prefix"`
+	// NodeId identifies the gateway in discovery topics and Home Assistant unique ids
+	NodeId string `yaml:"node_id"`
+	// KeepAlive is the interval the broker expects a packet in, the connection is pinged twice as often. 0 disables it
+	KeepAlive time.Duration `yaml:"keep_alive"`
+}
+
+// DefaultMQTTConfig returns the settings used for everything the configuration doesn't set
+func DefaultMQTTConfig() *MQTTConfig {
+	return &MQTTConfig{
+		ClientId:        "fibertel-station-exporter",
+		TopicPrefix:     "fibertel",
+		Discovery:       true,
+		DiscoveryPrefix: "homeassistant",
+		NodeId:          "fibertel_gateway",
+		KeepAlive:       60 * time.Second,
+	}
+}
+
+// MQTTPublisher publishes the modem status of every poll to an MQTT broker. The availability
+// topic is retained and set to offline by the broker as last will when the exporter goes away.
+type MQTTPublisher struct {
+	config  *MQTTConfig
+	network string
+	address string
+	// tls is nil for plain TCP brokers
+	tls    *tls.Config
+	latest chan *Notification
+
+	// conn is only used by the publishing goroutine, writeMu guards writes against the pinger
+	conn       net.Conn
+	writeMu    sync.Mutex
+	done       chan struct{}
+	discovered map[string]bool
+	// channels maps the state topic of every channel published so far to its discovery config
+	// topics, so both are cleared once the channel disappears
+	channels map[string][]string
+}
+
+func NewMQTTPublisher(config *MQTTConfig) (*MQTTPublisher, error) {
+	broker, err := url.Parse(config.Broker)
+	if err != nil {
+		return nil, err
+	}
+	publisher := &MQTTPublisher{
+		config:   config,
+		network:  "tcp",
+		address:  broker.Host,
+		latest:   make(chan *Notification, 1),
+		channels: make(map[string][]string),
+	}
+	switch broker.Scheme {
+	case "tcp", "mqtt":
+		if broker.Port() == "" {
+			publisher.address = net.JoinHostPort(broker.Host, "1883")
+		}
+	case "tls", "ssl", "mqtts":
+		publisher.tls = &tls.Config{InsecureSkipVerify: config.InsecureSkipVerify}
+		if config.CAFile != "" {
+			pem, err := os.ReadFile(config.CAFile)
+			if err != nil {
+				return nil, err
+			}
+			publisher.tls.RootCAs = x509.NewCertPool()
+			if !publisher.tls.RootCAs.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificates found in mqtt ca_file %q", config.CAFile)
+			}
+		}
+		if broker.Port() == "" {
+			publisher.address = net.JoinHostPort(broker.Host, "8883")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported mqtt broker %q, expected tcp://host:1883 or tls://host:8883", config.Broker)
+	}
+	go publisher.run()
+	return publisher, nil
+}
+
+// Notify hands the notification to the publishing goroutine, replacing one it didn't get to yet
+func (p *MQTTPublisher) Notify(notification *Notification) {
+	for {
+		select {
+		case p.latest <- notification:
+			return
+		default:
+		}
+		select {
+		case <-p.latest:
+		default:
+		}
+	}
+}
+
+func (p *MQTTPublisher) run() {
+	for notification := range p.latest {
+		if err := p.publishNotification(notification); err != nil {
+			log.Errorf("error publishing to mqtt broker %s: %s", p.address, err.Error())
+			p.disconnect()
+		}
+	}
+}
+
+func (p *MQTTPublisher) topic(suffix string) string {
+	return p.config.TopicPrefix + "/" + suffix
+}
+
+// channelTopic identifies a channel by its frequency, channel ids are reassigned by the CMTS
+func (p *MQTTPublisher) channelTopic(channel *ReportChannel) string {
+	return p.topic(channel.Direction + "/" + normalizeFrequencyLabel(channel.Frequency))
+}
+
+func (p *MQTTPublisher) discoveryTopic(component, object string) string {
+	return p.config.DiscoveryPrefix + "/" + component + "/" + p.config.NodeId + "/" + object + "/config"
+}
+
+// connect opens the connection with the last will and marks the exporter as available
+func (p *MQTTPublisher) connect() error {
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	var conn net.Conn
+	var err error
+	if p.tls != nil {
+		conn, err = tls.DialWithDialer(dialer, p.network, p.address, p.tls)
+	} else {
+		conn, err = dialer.Dial(p.network, p.address)
+	}
+	if err != nil {
+		return err
+	}
+
+	var body bytes.Buffer
+	mqttWriteString(&body, "MQTT")
+	// protocol level 4 is MQTT 3.1.1, the flags request a clean session and a retained will
+	flags := byte(0x02 | 0x04 | 0x20)
+	if p.config.Username != "" {
+		flags |= 0x80
+		if p.config.Password != "" {
+			flags |= 0x40
+		}
+	}
+	body.WriteByte(4)
+	body.WriteByte(flags)
+	binary.Write(&body, binary.BigEndian, uint16(p.config.KeepAlive/time.Second))
+	mqttWriteString(&body, p.config.ClientId)
+	mqttWriteString(&body, p.topic("availability"))
+	mqttWriteString(&body, mqttOffline)
+	if p.config.Username != "" {
+		mqttWriteString(&body, p.config.Username)
+		if p.config.Password != "" {
+			mqttWriteString(&body, p.config.Password)
+		}
+	}
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	if _, err := conn.Write(mqttPacket(mqttConnect, body.Bytes())); err != nil {
+		conn.Close()
+		return err
+	}
+	reader := bufio.NewReader(conn)
+	header, ack, err := mqttReadPacket(reader)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	if header&0xf0 != mqttConnack || len(ack) != 2 {
+		conn.Close()
+		return fmt.Errorf("unexpected packet %#x instead of CONNACK", header)
+	}
+	if ack[1] != 0 {
+		conn.Close()
+		return fmt.Errorf("connection refused with return code %d", ack[1])
+	}
+	conn.SetDeadline(time.Time{})
+
+	p.conn = conn
+	p.done = make(chan struct{})
+	p.discovered = make(map[string]bool)
+	go p.keepAlive(conn, reader, p.done)
+	return p.publish(p.topic("availability"), []byte(mqttOnline), true)
+}
+
+// keepAlive pings the broker and discards what it sends, i.e. PINGRESP, until the connection fails
+func (p *MQTTPublisher) keepAlive(conn net.Conn, reader *bufio.Reader, done chan struct{}) {
+	go func() {
+		for {
+			if _, _, err := mqttReadPacket(reader); err != nil {
+				conn.Close()
+				return
+			}
+		}
+	}()
+	if p.config.KeepAlive <= 0 {
+		return
+	}
+	ticker := time.NewTicker(p.config.KeepAlive / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			p.writeMu.Lock()
+			conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			_, err := conn.Write(mqttPacket(mqttPingreq, nil))
+			p.writeMu.Unlock()
+			if err != nil {
+				conn.Close()
+				return
+			}
+		}
+	}
+}
+
+func (p *MQTTPublisher) disconnect() {
+	if p.conn == nil {
+		return
+	}
+	close(p.done)
+	p.conn.Close()
+	p.conn = nil
+}
+
+// publish sends a message with QoS 0
+func (p *MQTTPublisher) publish(topic string, payload []byte, retain bool) error {
+	var body bytes.Buffer
+	mqttWriteString(&body, topic)
+	body.Write(payload)
+	header := byte(mqttPublish)
+	if retain {
+		header |= 0x01
+	}
+	p.writeMu.Lock()
+	defer p.writeMu.Unlock()
+	p.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	_, err := p.conn.Write(mqttPacket(header, body.Bytes()))
+	return err
+}
+
+func (p *MQTTPublisher) publishJSON(topic string, v interface{}, retain bool) error {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return p.publish(topic, payload, retain)
+}
+
+// mqttState is published to <prefix>/state on every poll
+type mqttState struct {
+	Login                    string  `json:"login"`
+	LoginError               string  `json:"login_error,omitempty"`
+	Health                   *Grade  `json:"health,omitempty"`
+	HealthScore              float64 `json:"health_score,omitempty"`
+	DownstreamChannels       int     `json:"downstream_channels"`
+	DownstreamLockedChannels int     `json:"downstream_locked_channels"`
+	UpstreamChannels         int     `json:"upstream_channels"`
+	UpstreamLockedChannels   int     `json:"upstream_locked_channels"`
+}
+
+// mqttChannel is published to <prefix>/<direction>/<frequency in MHz> on every poll
+type mqttChannel struct {
+	ChannelId    string   `json:"channel_id"`
+	FrequencyMHz float64  `json:"frequency_mhz"`
+	Power        float64  `json:"power_dbmv"`
+	Snr          *float64 `json:"snr_db,omitempty"`
+	Locked       bool     `json:"locked"`
+	Grade        Grade    `json:"grade"`
+}
+
+func (p *MQTTPublisher) publishNotification(notification *Notification) error {
+	if p.conn == nil {
+		if err := p.connect(); err != nil {
+			return err
+		}
+	}
+	state := &mqttState{Login: "ok", LoginError: notification.LoginError}
+	if notification.LoginError != "" {
+		state.Login = "failed"
+	}
+	var channels []*ReportChannel
+	if notification.Status != nil && notification.Health != nil {
+		overall := notification.Health.Overall()
+		state.Health = &overall
+		state.HealthScore = notification.Health.Score
+		summary := Summarize(notification.Status)
+		state.DownstreamChannels, state.DownstreamLockedChannels = summary.Downstream.Channels, summary.Downstream.LockedChannels
+		state.UpstreamChannels, state.UpstreamLockedChannels = summary.Upstream.Channels, summary.Upstream.LockedChannels
+		channels = reportChannels(notification.Status, notification.Health)
+	}
+
+	if p.config.Discovery {
+		if err := p.publishDiscovery(notification.Gateway, channels); err != nil {
+			return err
+		}
+	}
+	if err := p.publishJSON(p.topic("state"), state, p.config.Retain); err != nil {
+		return err
+	}
+	for _, channel := range channels {
+		payload := &mqttChannel{
+			ChannelId:    channel.ChannelId,
+			FrequencyMHz: parseFrequencyMHz(channel.Frequency),
+			Power:        parse2float(channel.Power),
+			Locked:       channel.Locked == "Locked",
+			Grade:        channel.Grade,
+		}
+		if channel.Snr != "" {
+			snr := parse2float(channel.Snr)
+			payload.Snr = &snr
+		}
+		topic := p.channelTopic(channel)
+		if err := p.publishJSON(topic, payload, p.config.Retain); err != nil {
+			return err
+		}
+		if _, ok := p.channels[topic]; !ok {
+			p.channels[topic] = nil
+		}
+	}
+	// without modem status or while the line is down nothing is known about the channels
+	if len(channels) > 0 {
+		return p.removeChannels(channels)
+	}
+	return nil
+}
+
+// removeChannels clears the retained state and the discovery configs of the channels that are
+// gone, so Home Assistant removes their sensors instead of keeping them unavailable
+func (p *MQTTPublisher) removeChannels(channels []*ReportChannel) error {
+	current := make(map[string]bool)
+	for _, channel := range channels {
+		current[p.channelTopic(channel)] = true
+	}
+	for topic, configs := range p.channels {
+		if current[topic] {
+			continue
+		}
+		for _, config := range configs {
+			if err := p.publish(config, nil, true); err != nil {
+				return err
+			}
+			delete(p.discovered, config)
+		}
+		if p.config.Retain {
+			if err := p.publish(topic, nil, true); err != nil {
+				return err
+			}
+		}
+		delete(p.channels, topic)
+	}
+	return nil
+}
+
+// haDiscovery is a Home Assistant MQTT discovery config of a sensor or binary sensor
+type haDiscovery struct {
+	Name              string    `json:"name"`
+	UniqueId          string    `json:"unique_id"`
+	StateTopic        string    `json:"state_topic"`
+	ValueTemplate     string    `json:"value_template"`
+	UnitOfMeasurement string    `json:"unit_of_measurement,omitempty"`
+	DeviceClass       string    `json:"device_class,omitempty"`
+	StateClass        string    `json:"state_class,omitempty"`
+	AvailabilityTopic string    `json:"availability_topic"`
+	Device            *haDevice `json:"device"`
+}
+
+type haDevice struct {
+	Identifiers      []string `json:"identifiers"`
+	Name             string   `json:"name"`
+	ConfigurationUrl string   `json:"configuration_url,omitempty"`
+}
+
+// publishDiscovery publishes the discovery configs of the sensors that weren't announced on this
+// connection yet. They are retained, so Home Assistant picks them up when it restarts.
+func (p *MQTTPublisher) publishDiscovery(gateway string, channels []*ReportChannel) error {
+	device := &haDevice{
+		Identifiers:      []string{p.config.NodeId},
+		Name:             "Fibertel gateway",
+		ConfigurationUrl: gateway,
+	}
+	announce := func(component, object string, config *haDiscovery) error {
+		topic := p.discoveryTopic(component, object)
+		if p.discovered[topic] {
+			return nil
+		}
+		config.UniqueId = p.config.NodeId + "_" + object
+		config.AvailabilityTopic = p.topic("availability")
+		config.Device = device
+		if err := p.publishJSON(topic, config, true); err != nil {
+			return err
+		}
+		p.discovered[topic] = true
+		return nil
+	}
+
+	state := p.topic("state")
+	sensors := []struct {
+		component, object string
+		config            *haDiscovery
+	}{
+		{"binary_sensor", "login_problem", &haDiscovery{Name: "Login problem", StateTopic: state, DeviceClass: "problem",
+			ValueTemplate: "{{ 'ON' if value_json.login != 'ok' else 'OFF' }}"}},
+		{"sensor", "health", &haDiscovery{Name: "Line health", StateTopic: state, ValueTemplate: "{{ value_json.health }}"}},
+		{"sensor", "health_score", &haDiscovery{Name: "Line health score", StateTopic: state, StateClass: "measurement",
+			ValueTemplate: "{{ value_json.health_score }}"}},
+		{"sensor", "downstream_locked_channels", &haDiscovery{Name: "Downstream locked channels", StateTopic: state, StateClass: "measurement",
+			ValueTemplate: "{{ value_json.downstream_locked_channels }}"}},
+		{"sensor", "upstream_locked_channels", &haDiscovery{Name: "Upstream locked channels", StateTopic: state, StateClass: "measurement",
+			ValueTemplate: "{{ value_json.upstream_locked_channels }}"}},
+	}
+	for _, sensor := range sensors {
+		if err := announce(sensor.component, sensor.object, sensor.config); err != nil {
+			return err
+		}
+	}
+
+	for _, channel := range channels {
+		key := normalizeFrequencyLabel(channel.Frequency)
+		topic := p.channelTopic(channel)
+		name := directionTitle(channel.Direction) + " " + key + " MHz"
+		// object ids may only contain letters, digits, underscores and hyphens
+		object := channel.Direction + "_" + strings.Replace(key, ".", "_", -1)
+		// clearing the SNR config of a channel that never had one is harmless
+		configs := []string{p.discoveryTopic("sensor", object+"_power"), p.discoveryTopic("sensor", object+"_snr"), p.discoveryTopic("binary_sensor", object+"_locked")}
+		if err := announce("sensor", object+"_power", &haDiscovery{Name: name + " power", StateTopic: topic, UnitOfMeasurement: "dBmV",
+			StateClass: "measurement", ValueTemplate: "{{ value_json.power_dbmv }}"}); err != nil {
+			return err
+		}
+		if channel.Snr != "" {
+			if err := announce("sensor", object+"_snr", &haDiscovery{Name: name + " SNR", StateTopic: topic, UnitOfMeasurement: "dB",
+				DeviceClass: "signal_strength", StateClass: "measurement", ValueTemplate: "{{ value_json.snr_db }}"}); err != nil {
+				return err
+			}
+		}
+		if err := announce("binary_sensor", object+"_locked", &haDiscovery{Name: name + " locked", StateTopic: topic, DeviceClass: "connectivity",
+			ValueTemplate: "{{ 'ON' if value_json.locked else 'OFF' }}"}); err != nil {
+			return err
+		}
+		p.channels[topic] = configs
+	}
+	return nil
+}
+
+func mqttWriteString(buf *bytes.Buffer, str string) {
+	binary.Write(buf, binary.BigEndian, uint16(len(str)))
+	buf.WriteString(str)
+}
+
+// mqttPacket prepends the fixed header with the variable length encoded remaining length
+func mqttPacket(header byte, body []byte) []byte {
+	packet := []byte{header}
+	length := len(body)
+	for {
+		digit := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			digit |= 0x80
+		}
+		packet = append(packet, digit)
+		if length == 0 {
+			break
+		}
+	}
+	return append(packet, body...)
+}
+
+func mqttReadPacket(reader *bufio.Reader) (byte, []byte, error) {
+	header, err := reader.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	length, multiplier := 0, 1
+	for i := 0; ; i++ {
+		digit, err := reader.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		length += int(digit&0x7f) * multiplier
+		multiplier *= 128
+		if digit&0x80 == 0 {
+			break
+		}
+		if i == 3 {
+			return 0, nil, fmt.Errorf("malformed remaining length")
+		}
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(reader, body); err != nil {
+		return 0, nil, err
+	}
+	return header, body, nil
+}
@@ -0,0 +1,262 @@
+package collector_test
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/pem"
+	"github.com/reynico/fibertel-station-exporter/collector"
+	"io"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type mqttMessage struct {
+	topic   string
+	payload string
+	retain  bool
+}
+
+type mqttConnect struct {
+	clientId, willTopic, willMessage, username, password string
+	willRetain                                           bool
+}
+
+// newTestMQTTBroker starts a stand-in for an MQTT broker that accepts every connection and
+// records CONNECT and PUBLISH packets. It serves TLS unless tlsConfig is nil.
+func newTestMQTTBroker(t *testing.T, tlsConfig *tls.Config) (net.Listener, chan *mqttConnect, chan *mqttMessage) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tlsConfig != nil {
+		listener = tls.NewListener(listener, tlsConfig)
+	}
+	t.Cleanup(func() { listener.Close() })
+	connects := make(chan *mqttConnect, 10)
+	messages := make(chan *mqttMessage, 100)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveMQTT(conn, connects, messages)
+		}
+	}()
+	return listener, connects, messages
+}
+
+func serveMQTT(conn net.Conn, connects chan *mqttConnect, messages chan *mqttMessage) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for {
+		header, err := reader.ReadByte()
+		if err != nil {
+			return
+		}
+		length, multiplier := 0, 1
+		for {
+			digit, err := reader.ReadByte()
+			if err != nil {
+				return
+			}
+			length += int(digit&0x7f) * multiplier
+			multiplier *= 128
+			if digit&0x80 == 0 {
+				break
+			}
+		}
+		body := make([]byte, length)
+		if _, err := io.ReadFull(reader, body); err != nil {
+			return
+		}
+		readString := func() string {
+			size := int(binary.BigEndian.Uint16(body))
+			str := string(body[2 : 2+size])
+			body = body[2+size:]
+			return str
+		}
+		switch header >> 4 {
+		case 1:
+			readString()
+			flags := body[1]
+			body = body[4:]
+			connect := &mqttConnect{clientId: readString(), willRetain: flags&0x20 != 0}
+			if flags&0x04 != 0 {
+				connect.willTopic, connect.willMessage = readString(), readString()
+			}
+			if flags&0x80 != 0 {
+				connect.username = readString()
+			}
+			if flags&0x40 != 0 {
+				connect.password = readString()
+			}
+			connects <- connect
+			conn.Write([]byte{0x20, 0x02, 0x00, 0x00})
+		case 3:
+			topic := readString()
+			messages <- &mqttMessage{topic: topic, payload: string(body), retain: header&0x01 != 0}
+		case 12:
+			conn.Write([]byte{0xd0, 0x00})
+		}
+	}
+}
+
+func TestMQTTPublisher(t *testing.T) {
+	listener, connects, messages := newTestMQTTBroker(t, nil)
+	config := collector.DefaultMQTTConfig()
+	config.Broker = "tcp://" + listener.Addr().String()
+	config.Username = "exporter"
+	config.Password = "s3cret"
+	publisher, err := collector.NewMQTTPublisher(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := newTestModemStatusData()
+	publisher.Notify(&collector.Notification{Time: time.Now(), Gateway: "http://192.168.100.1", Status: data, Health: collector.EvaluateHealth(data, nil)})
+
+	select {
+	case connect := <-connects:
+		if connect.willTopic != "fibertel/availability" || connect.willMessage != "offline" || !connect.willRetain {
+			t.Errorf("expected a retained offline last will, got %+v", connect)
+		}
+		if connect.username != "exporter" || connect.password != "s3cret" {
+			t.Errorf("unexpected credentials %+v", connect)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected a connection")
+	}
+
+	received := make(map[string]*mqttMessage)
+	timeout := time.After(2 * time.Second)
+	// the upstream channels are published last
+	for received["fibertel/upstream/37"] == nil {
+		select {
+		case message := <-messages:
+			received[message.topic] = message
+		case <-timeout:
+			t.Fatalf("expected more messages, got %d", len(received))
+		}
+	}
+
+	if availability := received["fibertel/availability"]; availability == nil || availability.payload != "online" || !availability.retain {
+		t.Errorf("expected a retained online availability, got %+v", availability)
+	}
+	var state map[string]interface{}
+	if message := received["fibertel/state"]; message == nil || json.Unmarshal([]byte(message.payload), &state) != nil {
+		t.Fatalf("expected the state, got %+v", message)
+	}
+	if state["login"] != "ok" || state["downstream_locked_channels"] != 4.0 || state["health"] == nil {
+		t.Errorf("unexpected state %+v", state)
+	}
+	var channel map[string]interface{}
+	if message := received["fibertel/downstream/609"]; message == nil || json.Unmarshal([]byte(message.payload), &channel) != nil {
+		t.Fatalf("expected downstream channel 2, got %+v", message)
+	}
+	if channel["channel_id"] != "2" || channel["power_dbmv"] != -8.1 || channel["snr_db"] != 31.2 || channel["locked"] != true || channel["grade"] != "marginal" {
+		t.Errorf("unexpected downstream channel 2 %+v", channel)
+	}
+
+	var discovery map[string]interface{}
+	message := received["homeassistant/sensor/fibertel_gateway/downstream_609_power/config"]
+	if message == nil || !message.retain || json.Unmarshal([]byte(message.payload), &discovery) != nil {
+		t.Fatalf("expected a retained discovery config for the downstream channel 2 power, got %+v", message)
+	}
+	if discovery["state_topic"] != "fibertel/downstream/609" || discovery["unit_of_measurement"] != "dBmV" || discovery["availability_topic"] != "fibertel/availability" {
+		t.Errorf("unexpected discovery config %+v", discovery)
+	}
+	if device, _ := discovery["device"].(map[string]interface{}); device == nil || device["configuration_url"] != "http://192.168.100.1" {
+		t.Errorf("expected the gateway device in the discovery config, got %+v", discovery["device"])
+	}
+	if received["homeassistant/sensor/fibertel_gateway/upstream_30_6_snr/config"] != nil {
+		t.Errorf("expected no SNR sensor for upstream channels")
+	}
+
+	// a failed login is published as state, discovery configs aren't repeated on the connection
+	publisher.Notify(&collector.Notification{Time: time.Now(), LoginError: "wrong password"})
+	select {
+	case message := <-messages:
+		if message.topic != "fibertel/state" || json.Unmarshal([]byte(message.payload), &state) != nil || state["login"] != "failed" {
+			t.Errorf("expected a failed login state, got %+v", message)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected the state")
+	}
+
+	// the CMTS moves downstream channel 2 to another frequency
+	data.Downstream[1].CentralFrequency = "633 MHz"
+	publisher.Notify(&collector.Notification{Time: time.Now(), Status: data, Health: collector.EvaluateHealth(data, nil)})
+	received = make(map[string]*mqttMessage)
+	timeout = time.After(2 * time.Second)
+	for received["homeassistant/binary_sensor/fibertel_gateway/downstream_609_locked/config"] == nil {
+		select {
+		case message := <-messages:
+			received[message.topic] = message
+		case <-timeout:
+			t.Fatalf("expected the discovery configs of the vanished channel to be cleared, got %d messages", len(received))
+		}
+	}
+	for _, topic := range []string{"homeassistant/sensor/fibertel_gateway/downstream_609_power/config", "homeassistant/binary_sensor/fibertel_gateway/downstream_609_locked/config"} {
+		if message := received[topic]; message == nil || message.payload != "" || !message.retain {
+			t.Errorf("expected an empty retained config on %s, got %+v", topic, message)
+		}
+	}
+	if received["homeassistant/sensor/fibertel_gateway/downstream_633_power/config"] == nil || received["fibertel/downstream/633"] == nil {
+		t.Errorf("expected the channel to be published with its new frequency")
+	}
+}
+
+func TestMQTTPublisherTLS(t *testing.T) {
+	// borrows the self-signed certificate of a test HTTPS server
+	server := httptest.NewTLSServer(nil)
+	defer server.Close()
+	listener, connects, _ := newTestMQTTBroker(t, server.TLS)
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		caFile   string
+		insecure bool
+		connects bool
+	}{
+		{connects: false},
+		{caFile: caFile, connects: true},
+		{insecure: true, connects: true},
+	} {
+		config := collector.DefaultMQTTConfig()
+		config.Broker = "tls://" + listener.Addr().String()
+		config.CAFile = test.caFile
+		config.InsecureSkipVerify = test.insecure
+		publisher, err := collector.NewMQTTPublisher(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		publisher.Notify(&collector.Notification{Time: time.Now(), LoginError: "wrong password"})
+		select {
+		case <-connects:
+			if !test.connects {
+				t.Errorf("expected the self-signed certificate to be rejected")
+			}
+		case <-time.After(500 * time.Millisecond):
+			if test.connects {
+				t.Errorf("expected a connection with ca_file %q and insecure_skip_verify %v", test.caFile, test.insecure)
+			}
+		}
+	}
+
+	config := collector.DefaultMQTTConfig()
+	config.Broker = "tls://" + listener.Addr().String()
+	config.CAFile = filepath.Join(t.TempDir(), "missing.pem")
+	if _, err := collector.NewMQTTPublisher(config); err == nil {
+		t.Errorf("expected an error for a missing ca_file")
+	}
+}
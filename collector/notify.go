@@ -0,0 +1,301 @@
+package collector
+
+import (
+	"fmt"
+	"github.com/prometheus/common/log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kinds of line state transitions notifiers are told about
+const (
+	EventLoginFailed            = "login_failed"
+	EventLoginRecovered         = "login_recovered"
+	EventChannelUnlocked        = "channel_unlocked"
+	EventChannelRelocked        = "channel_relocked"
+	EventBondedChannelsDropped  = "bonded_channels_dropped"
+	EventBondedChannelsRestored = "bonded_channels_restored"
+	EventDefaultPassword        = "default_password"
+	EventHealthChanged          = "health_changed"
+	EventGatewayUnreachable     = "gateway_unreachable"
+	EventGatewayReachable       = "gateway_reachable"
+)
+
+// Event is a single transition of the line state
+type Event struct {
+	Time         time.Time `json:"time"`
+	Kind         string    `json:"kind"`
+	Direction    string    `json:"direction,omitempty"`
+	ChannelId    string    `json:"channel_id,omitempty"`
+	FrequencyMHz float64   `json:"frequency_mhz,omitempty"`
+	Check        string    `json:"check,omitempty"`
+	// Previous and Current are the grades of a health change
+	Previous string `json:"previous,omitempty"`
+	Current  string `json:"current,omitempty"`
+	Message  string `json:"message"`
+}
+
+// key identifies what the event is about, so an event and its opposite can cancel each other
+func (e *Event) key() string {
+	return e.Direction + "/" + e.ChannelId + "/" + e.Check
+}
+
+// cancels returns whether the event undoes the earlier one
+func (e *Event) cancels(earlier *Event) bool {
+	if e.key() != earlier.key() {
+		return false
+	}
+	if e.Kind == EventHealthChanged {
+		return earlier.Kind == EventHealthChanged && earlier.Previous == e.Current
+	}
+	return opposites[e.Kind] == earlier.Kind
+}
+
+// opposites maps the kinds that end a condition to the kinds that start it
+var opposites = map[string]string{
+	EventLoginRecovered:         EventLoginFailed,
+	EventChannelRelocked:        EventChannelUnlocked,
+	EventBondedChannelsRestored: EventBondedChannelsDropped,
+	EventGatewayReachable:       EventGatewayUnreachable,
+}
+
+// Notification are the events of a poll along with the modem status, which is nil if the gateway
+// couldn't be polled
+type Notification struct {
+	Time    time.Time `json:"time"`
+	Gateway string    `json:"gateway"`
+	Events  []*Event  `json:"events"`
+	// LoginError is why the login failed, empty if it succeeded
+	LoginError string           `json:"login_error,omitempty"`
+	Status     *ModemStatusData `json:"-"`
+	Health     *LineHealth      `json:"-"`
+}
+
+// Text returns the events as plain text with one line per event
+func (n *Notification) Text() string {
+	lines := []string{fmt.Sprintf("Fibertel gateway %s:", n.Gateway)}
+	for _, event := range n.Events {
+		lines = append(lines, "- "+event.Message)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Notifier is told about the transitions of every poll. Notify must not block the collection.
+type Notifier interface {
+	Notify(notification *Notification)
+}
+
+// transitionState remembers the line state of the previous poll to detect transitions
+type transitionState struct {
+	loginFailed     bool
+	unreachable     bool
+	defaultPassword bool
+	bonded          map[string]int
+	grades          map[string]Grade
+}
+
+// transitions returns the events between the previous and this poll. data is nil if the modem
+// status couldn't be fetched, loginData is nil if the login failed.
+func (s *transitionState) transitions(now time.Time, loginErr error, loginData *LoginResponseData, data *ModemStatusData, health *LineHealth, changes []*ChannelChange) []*Event {
+	var events []*Event
+	unreachable := OutageCause(loginErr, nil) == OutageGatewayUnreachable
+	if unreachable && !s.unreachable {
+		events = append(events, &Event{Time: now, Kind: EventGatewayUnreachable, Message: "The gateway is unreachable: " + loginErr.Error()})
+	}
+	if !unreachable && s.unreachable {
+		events = append(events, &Event{Time: now, Kind: EventGatewayReachable, Message: "The gateway is reachable again"})
+	}
+	s.unreachable = unreachable
+	// an unreachable gateway fails the login as well, which is already told by the events above
+	if unreachable {
+		return events
+	}
+	if loginErr != nil {
+		if !s.loginFailed {
+			events = append(events, &Event{Time: now, Kind: EventLoginFailed, Message: "Login to the gateway failed: " + loginErr.Error()})
+		}
+		s.loginFailed = true
+		return events
+	}
+	if s.loginFailed {
+		events = append(events, &Event{Time: now, Kind: EventLoginRecovered, Message: "Login to the gateway recovered"})
+	}
+	s.loginFailed = false
+
+	if loginData != nil {
+		defaultPassword := loginData.DefaultPassword == "Yes"
+		if defaultPassword && !s.defaultPassword {
+			events = append(events, &Event{Time: now, Kind: EventDefaultPassword, Message: "The gateway still uses the default password"})
+		}
+		s.defaultPassword = defaultPassword
+	}
+
+	for _, change := range changes {
+		event := &Event{Time: now, Direction: change.Direction, ChannelId: change.ChannelId, FrequencyMHz: change.FrequencyMHz}
+		switch change.Kind {
+		case ChangeUnlocked:
+			event.Kind = EventChannelUnlocked
+		case ChangeRelocked:
+			event.Kind = EventChannelRelocked
+		default:
+			continue
+		}
+		event.Message = fmt.Sprintf("%s channel %s (%g MHz) %s", directionTitle(change.Direction), change.ChannelId, change.FrequencyMHz, change.Kind)
+		events = append(events, event)
+	}
+
+	if data != nil {
+		summary := Summarize(data)
+		bonded := map[string]int{
+			DirectionDownstream: summary.Downstream.LockedChannels,
+			DirectionUpstream:   summary.Upstream.LockedChannels,
+		}
+		for _, direction := range []string{DirectionDownstream, DirectionUpstream} {
+			previous, ok := s.bonded[direction]
+			if !ok || bonded[direction] == previous {
+				continue
+			}
+			event := &Event{Time: now, Kind: EventBondedChannelsDropped, Direction: direction}
+			verb := "dropped"
+			if bonded[direction] > previous {
+				event.Kind = EventBondedChannelsRestored
+				verb = "went up"
+			}
+			event.Message = fmt.Sprintf("%s bonded channels %s from %d to %d", directionTitle(direction), verb, previous, bonded[direction])
+			events = append(events, event)
+		}
+		s.bonded = bonded
+	}
+
+	if health != nil {
+		grades := make(map[string]Grade, len(health.Channels))
+		for _, check := range health.Channels {
+			key := check.Direction + "/" + check.ChannelId + "/" + check.Check
+			grades[key] = check.Grade
+			// power and SNR of unlocked channels aren't graded, relocking isn't a change of them
+			previous, ok := s.grades[key]
+			if !ok || previous == check.Grade {
+				continue
+			}
+			events = append(events, &Event{
+				Time:      now,
+				Kind:      EventHealthChanged,
+				Direction: check.Direction,
+				ChannelId: check.ChannelId,
+				Check:     check.Check,
+				Previous:  previous.String(),
+				Current:   check.Grade.String(),
+				Message:   fmt.Sprintf("%s channel %s %s changed from %s to %s", directionTitle(check.Direction), check.ChannelId, check.Check, previous, check.Grade),
+			})
+		}
+		s.grades = grades
+	}
+	return events
+}
+
+func directionTitle(direction string) string {
+	title := strings.Replace(direction, "_", " ", -1)
+	title = strings.Replace(title, "ofdm", "OFDM", 1)
+	return strings.ToUpper(title[:1]) + title[1:]
+}
+
+func (c *Collector) notify(loginErr error, loginData *LoginResponseData, data *ModemStatusData, changes []*ChannelChange) {
+	if len(c.Notifiers) == 0 {
+		return
+	}
+	now := time.Now()
+	var health *LineHealth
+	if data != nil {
+		health = EvaluateHealth(data, c.HealthProfile)
+	}
+	events := c.transitions.transitions(now, loginErr, loginData, data, health, changes)
+	notification := &Notification{Time: now, Gateway: c.Station.URL, Events: events, Status: data, Health: health}
+	if loginErr != nil {
+		notification.LoginError = loginErr.Error()
+	}
+	for _, notifier := range c.Notifiers {
+		notifier.Notify(notification)
+	}
+}
+
+// notifyQueue debounces notifications: events are collected for the debounce period and sent
+// as one notification, with an event and its opposite (e.g. a channel unlocking and relocking)
+// cancelling each other out. Failed sends are retried with exponential backoff.
+type notifyQueue struct {
+	debounce time.Duration
+	retries  int
+	backoff  time.Duration
+	send     func(notification *Notification) error
+
+	mu      sync.Mutex
+	pending *Notification
+	sendMu  sync.Mutex
+}
+
+func (q *notifyQueue) add(notification *Notification) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.pending == nil {
+		if len(notification.Events) == 0 {
+			return
+		}
+		q.pending = &Notification{Gateway: notification.Gateway}
+		time.AfterFunc(q.debounce, q.flush)
+	}
+	q.pending.Time = notification.Time
+	q.pending.Status = notification.Status
+	q.pending.Health = notification.Health
+	q.pending.LoginError = notification.LoginError
+	q.pending.Events = append(q.pending.Events, notification.Events...)
+}
+
+func (q *notifyQueue) flush() {
+	q.mu.Lock()
+	notification := q.pending
+	q.pending = nil
+	q.mu.Unlock()
+
+	notification.Events = coalesceEvents(notification.Events)
+	if len(notification.Events) == 0 {
+		return
+	}
+	q.sendMu.Lock()
+	defer q.sendMu.Unlock()
+	backoff := q.backoff
+	for attempt := 0; ; attempt++ {
+		err := q.send(notification)
+		if err == nil {
+			return
+		}
+		if attempt >= q.retries {
+			log.Errorf("error sending notification, giving up: %s", err.Error())
+			return
+		}
+		log.Warnf("error sending notification, retrying in %s: %s", backoff, err.Error())
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// coalesceEvents drops events that are cancelled by a later one, e.g. a channel unlocking and
+// relocking or its health going from good to marginal and back
+func coalesceEvents(events []*Event) []*Event {
+	dropped := make(map[int]bool)
+	for i, event := range events {
+		for j := i - 1; j >= 0; j-- {
+			if !dropped[j] && event.cancels(events[j]) {
+				dropped[i], dropped[j] = true, true
+				break
+			}
+		}
+	}
+	var kept []*Event
+	for i, event := range events {
+		if !dropped[i] {
+			kept = append(kept, event)
+		}
+	}
+	return kept
+}
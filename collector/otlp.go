@@ -0,0 +1,299 @@
+package collector
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	dto "github.com/prometheus/client_model/go"
+	"golang.org/x/net/http2"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// OTLP protocols, named like the values of OTEL_EXPORTER_OTLP_PROTOCOL
+const (
+	OTLPHTTP = "http/protobuf"
+	OTLPGRPC = "grpc"
+)
+
+const (
+	otlpScope    = "github.com/reynico/fibertel-station-exporter/collector"
+	otlpGRPCPath = "/opentelemetry.proto.collector.metrics.v1.MetricsService/Export"
+	// AGGREGATION_TEMPORALITY_CUMULATIVE
+	otlpCumulative = 2
+)
+
+// otlpUnits maps the unit suffixes of the metric names to UCUM units
+var otlpUnits = []struct {
+	suffix, unit string
+}{
+	{"_bytes_total", "By"},
+	{"_seconds_total", "s"},
+	{"_dBmV", "dBmV"},
+	{"_dB", "dB"},
+	{"_hertz", "Hz"},
+	{"_bytes", "By"},
+	{"_seconds", "s"},
+	{"_bool", "1"},
+}
+
+// OTLPConfig configures pushing the metrics to an OpenTelemetry receiver
+type OTLPConfig struct {
+	// Endpoint of the receiver, e.g. http://otel-collector:4318 for http/protobuf or
+	// http://otel-collector:4317 for grpc; https uses TLS
+	Endpoint string `yaml:"endpoint"`
+	// Protocol is http/protobuf (default) or grpc
+	Protocol string `yaml:"protocol"`
+	// Headers are added to every request, e.g. for authentication
+	Headers map[string]string `yaml:"headers"`
+	// ResourceAttributes are added to the detected gateway.model, gateway.firmware and gateway.url
+	ResourceAttributes map[string]string `yaml:"resource_attributes"`
+	Timeout            time.Duration     `yaml:"timeout"`
+}
+
+// DefaultOTLPConfig returns the settings used for everything the configuration doesn't set
+func DefaultOTLPConfig() *OTLPConfig {
+	return &OTLPConfig{
+		Protocol: OTLPHTTP,
+		Timeout:  10 * time.Second,
+	}
+}
+
+// OTLPExporter pushes the metrics of every poll to an OTLP receiver. Gauges become OTLP gauges,
+// counters cumulative monotonic sums.
+type OTLPExporter struct {
+	config  *OTLPConfig
+	gateway string
+	url     string
+	client  *http.Client
+	// start is the start time of the cumulative sums
+	start time.Time
+}
+
+func NewOTLPExporter(config *OTLPConfig, gateway string) (*OTLPExporter, error) {
+	endpoint, err := url.Parse(config.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if endpoint.Scheme != "http" && endpoint.Scheme != "https" {
+		return nil, fmt.Errorf("invalid otlp endpoint %q, expected e.g. http://otel-collector:4318", config.Endpoint)
+	}
+	exporter := &OTLPExporter{config: config, gateway: gateway, start: time.Now()}
+	switch config.Protocol {
+	case OTLPHTTP:
+		if !strings.HasSuffix(endpoint.Path, "/v1/metrics") {
+			endpoint.Path = strings.TrimSuffix(endpoint.Path, "/") + "/v1/metrics"
+		}
+		exporter.client = &http.Client{Timeout: config.Timeout}
+	case OTLPGRPC:
+		endpoint.Path = otlpGRPCPath
+		transport := &http2.Transport{}
+		if endpoint.Scheme == "http" {
+			// gRPC without TLS is HTTP/2 with prior knowledge
+			transport.AllowHTTP = true
+			transport.DialTLS = func(network, address string, _ *tls.Config) (net.Conn, error) {
+				return net.DialTimeout(network, address, config.Timeout)
+			}
+		}
+		exporter.client = &http.Client{Timeout: config.Timeout, Transport: transport}
+	default:
+		return nil, fmt.Errorf("unknown otlp protocol %q, expected http/protobuf or grpc", config.Protocol)
+	}
+	exporter.url = endpoint.String()
+	return exporter, nil
+}
+
+func (e *OTLPExporter) Push(families []*dto.MetricFamily, now time.Time) error {
+	request := e.encode(families, now)
+	if e.config.Protocol == OTLPGRPC {
+		return e.exportGRPC(request)
+	}
+	return e.exportHTTP(request)
+}
+
+// resourceAttributes returns the configured attributes and what is known about the gateway,
+// taken from fibertel_system_info
+func (e *OTLPExporter) resourceAttributes(families []*dto.MetricFamily) map[string]string {
+	attributes := map[string]string{
+		"service.name": "fibertel-station-exporter",
+		"gateway.url":  e.gateway,
+	}
+	for _, family := range families {
+		if family.GetName() != prefix+"system_info" || len(family.Metric) == 0 {
+			continue
+		}
+		for _, label := range family.Metric[0].Label {
+			switch label.GetName() {
+			case "model":
+				attributes["gateway.model"] = label.GetValue()
+			case "software_version":
+				attributes["gateway.firmware"] = label.GetValue()
+			}
+		}
+	}
+	for name, value := range e.config.ResourceAttributes {
+		attributes[name] = value
+	}
+	return attributes
+}
+
+// encode builds an ExportMetricsServiceRequest with a single resource and scope
+func (e *OTLPExporter) encode(families []*dto.MetricFamily, now time.Time) []byte {
+	request := &protoBuffer{}
+	request.message(1, func(resourceMetrics *protoBuffer) {
+		resourceMetrics.message(1, func(resource *protoBuffer) {
+			writeOTLPAttributes(resource, 1, e.resourceAttributes(families))
+		})
+		resourceMetrics.message(2, func(scopeMetrics *protoBuffer) {
+			scopeMetrics.message(1, func(scope *protoBuffer) {
+				scope.string(1, otlpScope)
+			})
+			for _, family := range families {
+				e.encodeMetric(scopeMetrics, family, now)
+			}
+		})
+	})
+	return request.Bytes()
+}
+
+func (e *OTLPExporter) encodeMetric(scopeMetrics *protoBuffer, family *dto.MetricFamily, now time.Time) {
+	var field int
+	switch family.GetType() {
+	case dto.MetricType_GAUGE, dto.MetricType_UNTYPED:
+		field = 5
+	case dto.MetricType_COUNTER:
+		field = 7
+	default:
+		return
+	}
+	scopeMetrics.message(2, func(metric *protoBuffer) {
+		metric.string(1, family.GetName())
+		metric.string(2, family.GetHelp())
+		for _, unit := range otlpUnits {
+			if strings.HasSuffix(family.GetName(), unit.suffix) {
+				metric.string(3, unit.unit)
+				break
+			}
+		}
+		metric.message(field, func(data *protoBuffer) {
+			for _, m := range family.Metric {
+				timestamp := now
+				if m.TimestampMs != nil {
+					timestamp = time.Unix(0, m.GetTimestampMs()*int64(time.Millisecond))
+				}
+				data.message(1, func(point *protoBuffer) {
+					var value float64
+					switch {
+					case m.Gauge != nil:
+						value = m.Gauge.GetValue()
+					case m.Counter != nil:
+						value = m.Counter.GetValue()
+						point.fixed64(2, uint64(e.start.UnixNano()))
+					case m.Untyped != nil:
+						value = m.Untyped.GetValue()
+					}
+					point.fixed64(3, uint64(timestamp.UnixNano()))
+					point.double(4, value)
+					attributes := make(map[string]string, len(m.Label))
+					for _, label := range m.Label {
+						attributes[label.GetName()] = label.GetValue()
+					}
+					writeOTLPAttributes(point, 7, attributes)
+				})
+			}
+			if field == 7 {
+				data.uint64(2, otlpCumulative)
+				data.bool(3, true)
+			}
+		})
+	})
+}
+
+// writeOTLPAttributes writes the attributes as KeyValue messages with string values, sorted by key
+func writeOTLPAttributes(b *protoBuffer, field int, attributes map[string]string) {
+	keys := make([]string, 0, len(attributes))
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		b.message(field, func(keyValue *protoBuffer) {
+			keyValue.string(1, key)
+			keyValue.message(2, func(value *protoBuffer) {
+				// the string_value of the oneof is written even if empty
+				value.tag(1, protoBytes)
+				value.varint(uint64(len(attributes[key])))
+				value.WriteString(attributes[key])
+			})
+		})
+	}
+}
+
+func (e *OTLPExporter) newRequest(body []byte, contentType string) (*http.Request, error) {
+	request, err := http.NewRequest(http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", contentType)
+	for name, value := range e.config.Headers {
+		request.Header.Set(name, value)
+	}
+	return request, nil
+}
+
+func (e *OTLPExporter) exportHTTP(body []byte) error {
+	request, err := e.newRequest(body, "application/x-protobuf")
+	if err != nil {
+		return err
+	}
+	response, err := e.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	io.Copy(io.Discard, response.Body)
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("otlp receiver responded %s", response.Status)
+	}
+	return nil
+}
+
+func (e *OTLPExporter) exportGRPC(body []byte) error {
+	// a gRPC message is prefixed with the compression flag and its length
+	message := make([]byte, 5, 5+len(body))
+	binary.BigEndian.PutUint32(message[1:], uint32(len(body)))
+	message = append(message, body...)
+	request, err := e.newRequest(message, "application/grpc")
+	if err != nil {
+		return err
+	}
+	request.Header.Set("TE", "trailers")
+	response, err := e.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	// the status is in the trailers, which are only available once the body is read
+	io.Copy(io.Discard, response.Body)
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("otlp receiver responded %s", response.Status)
+	}
+	status := response.Trailer.Get("Grpc-Status")
+	errorMessage := response.Trailer.Get("Grpc-Message")
+	if status == "" {
+		// trailers-only responses carry the status in the headers
+		status = response.Header.Get("Grpc-Status")
+		errorMessage = response.Header.Get("Grpc-Message")
+	}
+	if status != "0" {
+		errorMessage, _ = url.PathUnescape(errorMessage)
+		return fmt.Errorf("otlp receiver responded with gRPC status %s: %s", status, errorMessage)
+	}
+	return nil
+}
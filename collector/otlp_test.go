@@ -0,0 +1,198 @@
+package collector_test
+
+import (
+	"encoding/binary"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/reynico/fibertel-station-exporter/collector"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// protoField is a decoded protocol buffer field, value holds varints and fixed64s
+type protoField struct {
+	value uint64
+	bytes []byte
+}
+
+// decodeProto splits a protocol buffer message into its fields, keyed by field number
+func decodeProto(t *testing.T, message []byte) map[int][]protoField {
+	fields := make(map[int][]protoField)
+	for len(message) > 0 {
+		key, n := binary.Uvarint(message)
+		message = message[n:]
+		var field protoField
+		switch key & 7 {
+		case 0:
+			field.value, n = binary.Uvarint(message)
+			message = message[n:]
+		case 1:
+			field.value = binary.LittleEndian.Uint64(message)
+			message = message[8:]
+		case 2:
+			length, n := binary.Uvarint(message)
+			field.bytes = message[n : n+int(length)]
+			message = message[n+int(length):]
+		default:
+			t.Fatalf("unexpected wire type %d", key&7)
+		}
+		fields[int(key>>3)] = append(fields[int(key>>3)], field)
+	}
+	return fields
+}
+
+// otlpAttributes decodes repeated KeyValue messages with string values
+func otlpAttributes(t *testing.T, keyValues []protoField) map[string]string {
+	attributes := make(map[string]string)
+	for _, keyValue := range keyValues {
+		fields := decodeProto(t, keyValue.bytes)
+		value := decodeProto(t, fields[2][0].bytes)
+		attributes[string(fields[1][0].bytes)] = string(value[1][0].bytes)
+	}
+	return attributes
+}
+
+type otlpMetric struct {
+	unit      string
+	sum       bool
+	monotonic bool
+	points    []map[string]string
+	values    []float64
+}
+
+// decodeOTLP decodes an ExportMetricsServiceRequest into the resource attributes and metrics
+func decodeOTLP(t *testing.T, request []byte) (map[string]string, map[string]*otlpMetric) {
+	resourceMetrics := decodeProto(t, decodeProto(t, request)[1][0].bytes)
+	resource := otlpAttributes(t, decodeProto(t, resourceMetrics[1][0].bytes)[1])
+	metrics := make(map[string]*otlpMetric)
+	for _, encoded := range decodeProto(t, resourceMetrics[2][0].bytes)[2] {
+		fields := decodeProto(t, encoded.bytes)
+		metric := &otlpMetric{}
+		if len(fields[3]) > 0 {
+			metric.unit = string(fields[3][0].bytes)
+		}
+		data := fields[5]
+		if len(fields[7]) > 0 {
+			metric.sum, data = true, fields[7]
+		}
+		dataFields := decodeProto(t, data[0].bytes)
+		metric.monotonic = len(dataFields[3]) > 0 && dataFields[3][0].value == 1
+		for _, point := range dataFields[1] {
+			pointFields := decodeProto(t, point.bytes)
+			metric.points = append(metric.points, otlpAttributes(t, pointFields[7]))
+			metric.values = append(metric.values, math.Float64frombits(pointFields[4][0].value))
+		}
+		metrics[string(fields[1][0].bytes)] = metric
+	}
+	return resource, metrics
+}
+
+func gatherOTLPTestMetrics(t *testing.T) (string, *prometheus.Registry) {
+	station := newTestStation(t, newTestModemStatusData())
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(&collector.Collector{Station: collector.NewFibertelStation(station.URL, "custadmin", "password")})
+	counter := prometheus.NewCounter(prometheus.CounterOpts{Name: "fibertel_test_bytes_total", Help: "Bytes"})
+	counter.Add(42)
+	registry.MustRegister(counter)
+	return station.URL, registry
+}
+
+func checkOTLPRequest(t *testing.T, gateway string, request []byte) {
+	resource, metrics := decodeOTLP(t, request)
+	if resource["gateway.model"] != "CGA4233TCH3" || resource["gateway.firmware"] != "CGA4233TCH3-1.0.5" || resource["gateway.url"] != gateway || resource["site"] != "home" {
+		t.Errorf("unexpected resource attributes %+v", resource)
+	}
+	snr := metrics["fibertel_downstream_snr_dB"]
+	if snr == nil || snr.sum || snr.unit != "dB" || len(snr.points) != 4 {
+		t.Fatalf("expected the downstream SNR as gauge, got %+v", snr)
+	}
+	if snr.points[1]["channel_id"] != "2" || snr.values[1] != 31.2 {
+		t.Errorf("unexpected data point %+v %g", snr.points[1], snr.values[1])
+	}
+	if counter := metrics["fibertel_test_bytes_total"]; counter == nil || !counter.sum || !counter.monotonic || counter.unit != "By" || counter.values[0] != 42 {
+		t.Errorf("expected the counter as monotonic sum, got %+v", counter)
+	}
+}
+
+func TestOTLPExporterHTTP(t *testing.T) {
+	requests := make(chan []byte, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/metrics" || r.Header.Get("Content-Type") != "application/x-protobuf" || r.Header.Get("X-Api-Key") != "s3cret" {
+			t.Errorf("unexpected request %s %+v", r.URL, r.Header)
+		}
+		body, _ := io.ReadAll(r.Body)
+		requests <- body
+	}))
+	defer receiver.Close()
+
+	gateway, registry := gatherOTLPTestMetrics(t)
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := collector.DefaultOTLPConfig()
+	config.Endpoint = receiver.URL
+	config.Headers = map[string]string{"X-Api-Key": "s3cret"}
+	config.ResourceAttributes = map[string]string{"site": "home"}
+	exporter, err := collector.NewOTLPExporter(config, gateway)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := exporter.Push(families, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	checkOTLPRequest(t, gateway, <-requests)
+}
+
+func TestOTLPExporterGRPC(t *testing.T) {
+	requests := make(chan []byte, 2)
+	var status string
+	receiver := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 2 || r.URL.Path != "/opentelemetry.proto.collector.metrics.v1.MetricsService/Export" || r.Header.Get("Content-Type") != "application/grpc" {
+			t.Errorf("unexpected request %s %s %+v", r.Proto, r.URL, r.Header)
+		}
+		body, _ := io.ReadAll(r.Body)
+		if len(body) < 5 || int(binary.BigEndian.Uint32(body[1:5])) != len(body)-5 {
+			t.Errorf("expected a length-prefixed gRPC message")
+		} else {
+			requests <- body[5:]
+		}
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+		w.Write([]byte{0, 0, 0, 0, 0})
+		w.Header().Set("Grpc-Status", status)
+		if status != "0" {
+			w.Header().Set("Grpc-Message", "quota%20exceeded")
+		}
+	}), &http2.Server{}))
+	defer receiver.Close()
+
+	gateway, registry := gatherOTLPTestMetrics(t)
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := collector.DefaultOTLPConfig()
+	config.Endpoint = receiver.URL
+	config.Protocol = collector.OTLPGRPC
+	config.ResourceAttributes = map[string]string{"site": "home"}
+	exporter, err := collector.NewOTLPExporter(config, gateway)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status = "0"
+	if err := exporter.Push(families, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	checkOTLPRequest(t, gateway, <-requests)
+
+	status = "8"
+	if err := exporter.Push(families, time.Now()); err == nil || err.Error() != "otlp receiver responded with gRPC status 8: quota exceeded" {
+		t.Errorf("expected the gRPC status as error, got %v", err)
+	}
+}
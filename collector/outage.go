@@ -0,0 +1,282 @@
+package collector
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	outagesDesc       *prometheus.Desc
+	outageSecondsDesc *prometheus.Desc
+	outageActiveDesc  *prometheus.Desc
+)
+
+func init() {
+	outagesDesc = prometheus.NewDesc(prefix+"outages_total", "Number of outages", []string{"cause"}, nil)
+	outageSecondsDesc = prometheus.NewDesc(prefix+"outage_seconds_total", "Time spent in outages, including the ongoing one", []string{"cause"}, nil)
+	outageActiveDesc = prometheus.NewDesc(prefix+"outage_active_bool", "1 if there is an ongoing outage", nil, nil)
+}
+
+// Outage causes
+const (
+	OutageGatewayUnreachable = "gateway_unreachable"
+	OutageDownstreamUnlocked = "downstream_unlocked"
+	OutageNotRegistered      = "not_registered"
+)
+
+const (
+	// outageSaveInterval is how often the last observation of an ongoing outage is written to
+	// the log, starting and ending an outage is written right away
+	outageSaveInterval = time.Minute
+	// maxOutages is how many outages the log keeps, the oldest ones are dropped beyond it
+	maxOutages = 1000
+)
+
+// Outage is a period in which the line was down
+type Outage struct {
+	Start time.Time  `json:"start"`
+	End   *time.Time `json:"end,omitempty"`
+	Cause string     `json:"cause"`
+	// LastSeen is the latest observation of an ongoing outage
+	LastSeen *time.Time `json:"last_seen,omitempty"`
+}
+
+// Duration returns how long the outage lasted, or has lasted so far if it is ongoing
+func (o *Outage) Duration(now time.Time) time.Duration {
+	if o.End != nil {
+		return o.End.Sub(o.Start)
+	}
+	return now.Sub(o.Start)
+}
+
+// OutageCause returns why the line is down, or an empty string if it is up. A modem without any
+// locked upstream channel hasn't completed ranging and can't be registered with the CMTS.
+func OutageCause(loginErr error, data *ModemStatusData) string {
+	var urlError *url.Error
+	if errors.As(loginErr, &urlError) {
+		return OutageGatewayUnreachable
+	}
+	if data == nil {
+		return ""
+	}
+	summary := Summarize(data)
+	switch {
+	case summary.Downstream.LockedChannels == 0:
+		return OutageDownstreamUnlocked
+	case summary.Upstream.LockedChannels == 0:
+		return OutageNotRegistered
+	}
+	return ""
+}
+
+// OutageTracker records outages and persists them to a file so they survive restarts
+type OutageTracker struct {
+	path    string
+	mu      sync.Mutex
+	outages []*Outage
+	saved   time.Time
+}
+
+// NewOutageTracker loads the outage log from path. An empty path keeps the log in memory only.
+func NewOutageTracker(path string) (*OutageTracker, error) {
+	tracker := &OutageTracker{path: path}
+	if path == "" {
+		return tracker, nil
+	}
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return tracker, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(content, &tracker.outages); err != nil {
+		return nil, err
+	}
+	return tracker, nil
+}
+
+// CloseOngoing ends an outage that was still ongoing when the log was last written. Nothing is
+// known about the line while the exporter was stopped, so the outage ends with its last
+// observation rather than with the first one after the restart.
+func (t *OutageTracker) CloseOngoing() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	current := t.current()
+	if current == nil {
+		return nil
+	}
+	end := current.Start
+	if current.LastSeen != nil {
+		end = *current.LastSeen
+	}
+	current.End = &end
+	current.LastSeen = nil
+	log.Infof("Closing outage (%s) at its last observation %s", current.Cause, end.Format(time.RFC3339))
+	return t.save()
+}
+
+// Observe starts or ends an outage, cause is empty while the line is up
+func (t *OutageTracker) Observe(cause string, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	current := t.current()
+	if current == nil && cause == "" {
+		return
+	}
+	changed := false
+	switch {
+	case current != nil && current.Cause == cause:
+		current.LastSeen = &now
+	case current != nil:
+		current.End = &now
+		current.LastSeen = nil
+		changed = true
+		log.Infof("Outage (%s) ended after %s", current.Cause, current.Duration(now))
+	}
+	if cause != "" && (current == nil || current.Cause != cause) {
+		t.outages = append(t.outages, &Outage{Start: now, Cause: cause, LastSeen: &now})
+		changed = true
+		log.Infof("Outage (%s) started", cause)
+	}
+	// an ongoing outage only moves its last observation, which doesn't need a write every scrape
+	if !changed && now.Sub(t.saved) < outageSaveInterval {
+		return
+	}
+	if len(t.outages) > maxOutages {
+		t.outages = append([]*Outage(nil), t.outages[len(t.outages)-maxOutages:]...)
+	}
+	if err := t.save(); err != nil {
+		log.Errorf("error saving outage log: %s", err.Error())
+		return
+	}
+	t.saved = now
+}
+
+func (t *OutageTracker) current() *Outage {
+	if len(t.outages) == 0 || t.outages[len(t.outages)-1].End != nil {
+		return nil
+	}
+	return t.outages[len(t.outages)-1]
+}
+
+func (t *OutageTracker) save() error {
+	if t.path == "" {
+		return nil
+	}
+	content, err := json.MarshalIndent(t.outages, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(t.path, content)
+}
+
+// Outages returns the outages that overlap with the period since the given time, oldest first
+func (t *OutageTracker) Outages(since time.Time) []*Outage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	outages := []*Outage{}
+	for _, outage := range t.outages {
+		if outage.End == nil || outage.End.After(since) {
+			copied := *outage
+			outages = append(outages, &copied)
+		}
+	}
+	return outages
+}
+
+// WriteCSV writes the outages since the given time as CSV
+func (t *OutageTracker) WriteCSV(w io.Writer, since time.Time) error {
+	now := time.Now()
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"start", "end", "duration_seconds", "cause"})
+	for _, outage := range t.Outages(since) {
+		end := ""
+		if outage.End != nil {
+			end = outage.End.Format(time.RFC3339)
+		}
+		writer.Write([]string{outage.Start.Format(time.RFC3339), end, strconv.FormatFloat(outage.Duration(now).Seconds(), 'f', 0, 64), outage.Cause})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func (t *OutageTracker) collect(ch chan<- prometheus.Metric) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	counts := make(map[string]float64)
+	seconds := make(map[string]float64)
+	for _, outage := range t.outages {
+		counts[outage.Cause]++
+		seconds[outage.Cause] += outage.Duration(now).Seconds()
+	}
+	for _, cause := range []string{OutageGatewayUnreachable, OutageDownstreamUnlocked, OutageNotRegistered} {
+		ch <- prometheus.MustNewConstMetric(outagesDesc, prometheus.CounterValue, counts[cause], cause)
+		ch <- prometheus.MustNewConstMetric(outageSecondsDesc, prometheus.CounterValue, seconds[cause], cause)
+	}
+	ch <- prometheus.MustNewConstMetric(outageActiveDesc, prometheus.GaugeValue, bool2float64(t.current() != nil))
+}
+
+func (c *Collector) collectOutages(ch chan<- prometheus.Metric, loginErr error, data *ModemStatusData) {
+	if c.Outages == nil {
+		return
+	}
+	// a failed login for other reasons than the gateway being unreachable (e.g. a wrong password)
+	// or missing modem status doesn't tell whether the line is up or down
+	cause := OutageCause(loginErr, data)
+	if cause != "" || (loginErr == nil && data != nil) {
+		c.Outages.Observe(cause, time.Now())
+	}
+	c.Outages.collect(ch)
+}
+
+// writeFileAtomic replaces the file in one go, so readers never see a half written file
+func writeFileAtomic(path string, content []byte) error {
+	return replaceFile(path, func(w io.Writer) error {
+		_, err := w.Write(content)
+		return err
+	})
+}
+
+// replaceFile is writeFileAtomic for content written piece by piece by write
+func replaceFile(path string, write func(w io.Writer) error) error {
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	// temporary files are only readable by the owner, unlike files written the usual way
+	if err := file.Chmod(0644); err != nil {
+		file.Close()
+		return err
+	}
+	writer := bufio.NewWriter(file)
+	if err := write(writer); err != nil {
+		file.Close()
+		return err
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
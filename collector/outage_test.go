@@ -0,0 +1,145 @@
+package collector_test
+
+import (
+	"errors"
+	"github.com/reynico/fibertel-station-exporter/collector"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestOutageCause(t *testing.T) {
+	unreachable := &url.Error{Op: "Get", URL: "https://192.168.100.1", Err: errors.New("connection refused")}
+	if cause := collector.OutageCause(unreachable, nil); cause != collector.OutageGatewayUnreachable {
+		t.Errorf("expected %s, got %q", collector.OutageGatewayUnreachable, cause)
+	}
+	if cause := collector.OutageCause(errors.New("wrong password"), nil); cause != "" {
+		t.Errorf("expected no cause for a failed login, got %q", cause)
+	}
+
+	data := newTestModemStatusData()
+	if cause := collector.OutageCause(nil, data); cause != "" {
+		t.Errorf("expected no outage, got %q", cause)
+	}
+	for _, channel := range data.Upstream {
+		channel.Locked = "Not Locked"
+	}
+	if cause := collector.OutageCause(nil, data); cause != collector.OutageNotRegistered {
+		t.Errorf("expected %s, got %q", collector.OutageNotRegistered, cause)
+	}
+	for _, channel := range data.Downstream {
+		channel.Locked = "Not Locked"
+	}
+	for _, channel := range data.OfdmDownstreamData {
+		channel.LockedOfdm = "Not Locked"
+	}
+	if cause := collector.OutageCause(nil, data); cause != collector.OutageDownstreamUnlocked {
+		t.Errorf("expected %s, got %q", collector.OutageDownstreamUnlocked, cause)
+	}
+}
+
+func TestOutageTracker(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outages.json")
+	tracker, err := collector.NewOutageTracker(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	tracker.Observe("", start)
+	tracker.Observe(collector.OutageDownstreamUnlocked, start.Add(time.Minute))
+	tracker.Observe(collector.OutageDownstreamUnlocked, start.Add(2*time.Minute))
+	tracker.Observe(collector.OutageGatewayUnreachable, start.Add(3*time.Minute))
+	tracker.Observe("", start.Add(5*time.Minute))
+
+	outages := tracker.Outages(time.Time{})
+	if len(outages) != 2 {
+		t.Fatalf("expected 2 outages, got %d", len(outages))
+	}
+	if outages[0].Cause != collector.OutageDownstreamUnlocked || outages[0].Duration(start) != 2*time.Minute {
+		t.Errorf("unexpected first outage %+v", outages[0])
+	}
+	if outages[1].Cause != collector.OutageGatewayUnreachable || outages[1].End == nil {
+		t.Errorf("unexpected second outage %+v", outages[1])
+	}
+	if recent := tracker.Outages(start.Add(4 * time.Minute)); len(recent) != 1 {
+		t.Errorf("expected 1 outage in the last minutes, got %d", len(recent))
+	}
+
+	reloaded, err := collector.NewOutageTracker(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reloaded.Outages(time.Time{})) != 2 {
+		t.Errorf("expected the outages to be persisted, got %+v", reloaded.Outages(time.Time{}))
+	}
+}
+
+func TestOutageTrackerRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outages.json")
+	tracker, err := collector.NewOutageTracker(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	tracker.Observe(collector.OutageGatewayUnreachable, start)
+	tracker.Observe(collector.OutageGatewayUnreachable, start.Add(2*time.Minute))
+
+	// loading the log, e.g. for a report, leaves the outage ongoing
+	loaded, err := collector.NewOutageTracker(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if outages := loaded.Outages(time.Time{}); len(outages) != 1 || outages[0].End != nil {
+		t.Fatalf("expected the outage to be ongoing, got %+v", outages)
+	}
+
+	// the exporter is stopped during the outage and started again an hour later
+	restarted, err := collector.NewOutageTracker(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := restarted.CloseOngoing(); err != nil {
+		t.Fatal(err)
+	}
+	outages := restarted.Outages(time.Time{})
+	if len(outages) != 1 || outages[0].End == nil || !outages[0].End.Equal(start.Add(2*time.Minute)) {
+		t.Fatalf("expected the outage to end at its last observation, got %+v", outages)
+	}
+	restarted.Observe(collector.OutageGatewayUnreachable, start.Add(time.Hour))
+	if outages := restarted.Outages(time.Time{}); len(outages) != 2 || !outages[1].Start.Equal(start.Add(time.Hour)) {
+		t.Errorf("expected a new outage after the restart, got %+v", outages)
+	}
+}
+
+func TestOutageTrackerSaves(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outages.json")
+	tracker, err := collector.NewOutageTracker(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	tracker.Observe(collector.OutageGatewayUnreachable, start)
+	tracker.Observe(collector.OutageGatewayUnreachable, start.Add(30*time.Second))
+
+	// the observation half a minute in isn't written yet
+	loaded, err := collector.NewOutageTracker(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if outages := loaded.Outages(time.Time{}); len(outages) != 1 || !outages[0].LastSeen.Equal(start) {
+		t.Errorf("expected the last observation to be written once a minute, got %+v", outages)
+	}
+
+	for i := 1; i <= 1100; i++ {
+		tracker.Observe("", start.Add(time.Duration(2*i)*time.Minute))
+		tracker.Observe(collector.OutageDownstreamUnlocked, start.Add(time.Duration(2*i+1)*time.Minute))
+	}
+	loaded, err = collector.NewOutageTracker(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if outages := loaded.Outages(time.Time{}); len(outages) != 1000 || !outages[999].Start.Equal(start.Add(2201*time.Minute)) {
+		t.Errorf("expected the latest 1000 outages, got %d", len(outages))
+	}
+}
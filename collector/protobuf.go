@@ -0,0 +1,83 @@
+package collector
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+)
+
+// protoBuffer encodes protocol buffer messages field by field, which saves generated code for
+// the few messages pushed to OTLP and remote write receivers
+type protoBuffer struct {
+	bytes.Buffer
+}
+
+// protocol buffer wire types
+const (
+	protoVarint  = 0
+	protoFixed64 = 1
+	protoBytes   = 2
+)
+
+func (b *protoBuffer) varint(v uint64) {
+	var buf [binary.MaxVarintLen64]byte
+	b.Write(buf[:binary.PutUvarint(buf[:], v)])
+}
+
+func (b *protoBuffer) tag(field, wireType int) {
+	b.varint(uint64(field<<3 | wireType))
+}
+
+func (b *protoBuffer) uint64(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+	b.tag(field, protoVarint)
+	b.varint(v)
+}
+
+func (b *protoBuffer) int64(field int, v int64) {
+	b.uint64(field, uint64(v))
+}
+
+func (b *protoBuffer) bool(field int, v bool) {
+	if v {
+		b.uint64(field, 1)
+	}
+}
+
+func (b *protoBuffer) fixed64(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+	b.tag(field, protoFixed64)
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], v)
+	b.Write(buf[:])
+}
+
+// double is always written, as 0 is a value that matters for samples
+func (b *protoBuffer) double(field int, v float64) {
+	b.tag(field, protoFixed64)
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], math.Float64bits(v))
+	b.Write(buf[:])
+}
+
+func (b *protoBuffer) string(field int, v string) {
+	if v == "" {
+		return
+	}
+	b.tag(field, protoBytes)
+	b.varint(uint64(len(v)))
+	b.WriteString(v)
+}
+
+// message writes an embedded message built by fn
+func (b *protoBuffer) message(field int, fn func(m *protoBuffer)) {
+	m := &protoBuffer{}
+	fn(m)
+	b.tag(field, protoBytes)
+	b.varint(uint64(m.Len()))
+	b.Write(m.Bytes())
+}
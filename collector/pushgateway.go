@@ -0,0 +1,102 @@
+package collector
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// PushgatewayConfig configures pushing the metrics to a Pushgateway
+type PushgatewayConfig struct {
+	// URL of the Pushgateway, e.g. http://pushgateway:9091
+	URL string `yaml:"url"`
+	Job string `yaml:"job"`
+	// Grouping are further labels of the group the metrics are pushed to, e.g. the site
+	Grouping map[string]string `yaml:"grouping"`
+	Username string            `yaml:"username"`
+	Password string            `yaml:"password"`
+}
+
+// DefaultPushgatewayConfig returns the settings used for everything the configuration doesn't set
+func DefaultPushgatewayConfig() *PushgatewayConfig {
+	return &PushgatewayConfig{
+		Job: "fibertel_station_exporter",
+	}
+}
+
+// PushgatewayPusher replaces the metrics of its group on the Pushgateway with the ones of a poll
+type PushgatewayPusher struct {
+	config *PushgatewayConfig
+	client *http.Client
+}
+
+func NewPushgatewayPusher(config *PushgatewayConfig) (*PushgatewayPusher, error) {
+	if config.URL == "" || config.Job == "" {
+		return nil, fmt.Errorf("pushgateway needs a url and a job")
+	}
+	return &PushgatewayPusher{config: config, client: &http.Client{Timeout: 10 * time.Second}}, nil
+}
+
+func (p *PushgatewayPusher) Push(families []*dto.MetricFamily, now time.Time) error {
+	pusher := push.New(p.config.URL, p.config.Job).
+		Gatherer(prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) { return families, nil })).
+		Client(p.client)
+	names := make([]string, 0, len(p.config.Grouping))
+	for name := range p.config.Grouping {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		pusher = pusher.Grouping(name, p.config.Grouping[name])
+	}
+	if p.config.Username != "" {
+		pusher = pusher.BasicAuth(p.config.Username, p.config.Password)
+	}
+	return pusher.Push()
+}
+
+// TextfileConfig configures writing the metrics for the textfile collector of the node_exporter
+type TextfileConfig struct {
+	// Path of the file, in the directory of --collector.textfile.directory and ending with .prom
+	Path string `yaml:"path"`
+}
+
+// TextfileWriter writes the metrics of a poll to a .prom file. The file is replaced atomically,
+// so the node_exporter never reads a partially written one.
+type TextfileWriter struct {
+	config *TextfileConfig
+}
+
+func NewTextfileWriter(config *TextfileConfig) (*TextfileWriter, error) {
+	if filepath.Ext(config.Path) != ".prom" {
+		return nil, fmt.Errorf("textfile path %q must end with .prom to be read by the node_exporter", config.Path)
+	}
+	return &TextfileWriter{config: config}, nil
+}
+
+func (w *TextfileWriter) Push(families []*dto.MetricFamily, now time.Time) error {
+	var content bytes.Buffer
+	for _, family := range families {
+		if _, err := expfmt.MetricFamilyToText(&content, family); err != nil {
+			return err
+		}
+	}
+	return writeFileAtomic(w.config.Path, content.Bytes())
+}
+
+// LoginSucceeded returns whether the login of the poll the metrics are from succeeded
+func LoginSucceeded(families []*dto.MetricFamily) bool {
+	for _, family := range families {
+		if family.GetName() == prefix+"login_success_bool" && len(family.Metric) > 0 {
+			return family.Metric[0].GetGauge().GetValue() == 1
+		}
+	}
+	return false
+}
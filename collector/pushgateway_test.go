@@ -0,0 +1,102 @@
+package collector_test
+
+import (
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/reynico/fibertel-station-exporter/collector"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPushgatewayPusher(t *testing.T) {
+	type request struct {
+		method, path string
+		families     map[string]*dto.MetricFamily
+	}
+	requests := make(chan *request, 1)
+	pushgateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if username, password, _ := r.BasicAuth(); username != "exporter" || password != "s3cret" {
+			t.Errorf("unexpected credentials %q %q", username, password)
+		}
+		families := make(map[string]*dto.MetricFamily)
+		decoder := expfmt.NewDecoder(r.Body, expfmt.ResponseFormat(r.Header))
+		for {
+			family := &dto.MetricFamily{}
+			if err := decoder.Decode(family); err != nil {
+				break
+			}
+			families[family.GetName()] = family
+		}
+		requests <- &request{r.Method, r.URL.Path, families}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer pushgateway.Close()
+
+	families, err := gatherTestStation(t).Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !collector.LoginSucceeded(families) {
+		t.Errorf("expected the login to succeed")
+	}
+	config := collector.DefaultPushgatewayConfig()
+	config.URL = pushgateway.URL
+	config.Grouping = map[string]string{"site": "home"}
+	config.Username = "exporter"
+	config.Password = "s3cret"
+	pusher, err := collector.NewPushgatewayPusher(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pusher.Push(families, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	received := <-requests
+	if received.method != http.MethodPut || received.path != "/metrics/job/fibertel_station_exporter/site/home" {
+		t.Errorf("expected the group to be replaced, got %s %s", received.method, received.path)
+	}
+	if snr := received.families["fibertel_downstream_snr_dB"]; snr == nil || len(snr.Metric) != 4 {
+		t.Errorf("expected the downstream SNR, got %+v", snr)
+	}
+}
+
+func TestTextfileWriter(t *testing.T) {
+	families, err := gatherTestStation(t).Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := collector.NewTextfileWriter(&collector.TextfileConfig{Path: "fibertel.txt"}); err == nil {
+		t.Errorf("expected a path without .prom to be rejected")
+	}
+	path := filepath.Join(t.TempDir(), "fibertel.prom")
+	writer, err := collector.NewTextfileWriter(&collector.TextfileConfig{Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Push(families, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if info, _ := file.Stat(); info.Mode().Perm() != 0644 {
+		t.Errorf("expected the file to be readable by the node_exporter, got mode %s", info.Mode())
+	}
+	parsed, err := new(expfmt.TextParser).TextToMetricFamilies(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if login := parsed["fibertel_login_success_bool"]; login == nil || login.Metric[0].GetGauge().GetValue() != 1 {
+		t.Errorf("expected the login success in the textfile, got %+v", login)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(filepath.Dir(path), ".*")); len(matches) != 0 {
+		t.Errorf("expected no temporary files, got %v", matches)
+	}
+}
@@ -0,0 +1,284 @@
+package collector
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/golang/snappy"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/log"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultRemoteWriteBufferRetention is how long requests that couldn't be sent are kept on disk
+	DefaultRemoteWriteBufferRetention = 24 * time.Hour
+	// DefaultRemoteWriteBufferMaxSize bounds the buffer directory, the oldest requests go first
+	DefaultRemoteWriteBufferMaxSize = 64 << 20
+)
+
+const remoteWriteBufferSuffix = ".snappy"
+
+// RemoteWriteConfig configures pushing the metrics with the Prometheus remote write protocol
+type RemoteWriteConfig struct {
+	// URL of the receiver, e.g. https://prometheus.example.com/api/v1/write
+	URL         string `yaml:"url"`
+	Username    string `yaml:"username"`
+	Password    string `yaml:"password"`
+	BearerToken string `yaml:"bearer_token"`
+	// ExternalLabels are added to every series, e.g. to tell several homes apart
+	ExternalLabels map[string]string `yaml:"external_labels"`
+	// BufferPath is a directory requests are kept in while the receiver can't be reached, empty
+	// drops them
+	BufferPath      string        `yaml:"buffer_path"`
+	BufferRetention time.Duration `yaml:"buffer_retention"`
+	// BufferMaxSize is the size in bytes of the buffered requests beyond which the oldest are
+	// dropped, 0 bounds the buffer by BufferRetention only
+	BufferMaxSize int64         `yaml:"buffer_max_size"`
+	Timeout       time.Duration `yaml:"timeout"`
+}
+
+// DefaultRemoteWriteConfig returns the settings used for everything the configuration doesn't set
+func DefaultRemoteWriteConfig() *RemoteWriteConfig {
+	return &RemoteWriteConfig{
+		BufferRetention: DefaultRemoteWriteBufferRetention,
+		BufferMaxSize:   DefaultRemoteWriteBufferMaxSize,
+		Timeout:         30 * time.Second,
+	}
+}
+
+// RemoteWriter pushes the samples of every poll to a remote write receiver, for exporters no
+// Prometheus server can scrape. Requests that fail are buffered on disk and sent oldest first
+// once the receiver is reachable again.
+type RemoteWriter struct {
+	config *RemoteWriteConfig
+	client *http.Client
+
+	mu sync.Mutex
+}
+
+func NewRemoteWriter(config *RemoteWriteConfig) (*RemoteWriter, error) {
+	if config.URL == "" {
+		return nil, fmt.Errorf("remote write needs a url")
+	}
+	if config.BufferPath != "" {
+		if err := os.MkdirAll(config.BufferPath, 0755); err != nil {
+			return nil, err
+		}
+	}
+	return &RemoteWriter{
+		config: config,
+		client: &http.Client{Timeout: config.Timeout},
+	}, nil
+}
+
+// remoteWriteError is a response the request won't ever be accepted with, e.g. for samples that
+// are out of order or too old. Sending it again is pointless.
+type remoteWriteError struct {
+	status  string
+	message string
+}
+
+func (e *remoteWriteError) Error() string {
+	return fmt.Sprintf("remote write receiver responded %s: %s", e.status, e.message)
+}
+
+func (w *RemoteWriter) Push(families []*dto.MetricFamily, now time.Time) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	request := snappy.Encode(nil, encodeWriteRequest(families, w.config.ExternalLabels, now))
+	if err := w.flushBuffer(now); err != nil {
+		// keep the order of the samples, the receiver rejects older samples after newer ones
+		return w.buffer(request, now, err)
+	}
+	if err := w.send(request); err != nil {
+		if _, ok := err.(*remoteWriteError); ok {
+			return err
+		}
+		return w.buffer(request, now, err)
+	}
+	return nil
+}
+
+// buffer keeps the request on disk and returns the error that made it necessary
+func (w *RemoteWriter) buffer(request []byte, now time.Time, err error) error {
+	if w.config.BufferPath == "" {
+		return err
+	}
+	path := filepath.Join(w.config.BufferPath, strconv.FormatInt(now.UnixNano(), 10)+remoteWriteBufferSuffix)
+	if writeErr := writeFileAtomic(path, request); writeErr != nil {
+		log.Errorf("error buffering remote write request: %s", writeErr.Error())
+	}
+	w.trimBuffer()
+	return fmt.Errorf("%s, buffered the samples", err.Error())
+}
+
+// bufferedRequests returns the names of the buffered requests, oldest first
+func (w *RemoteWriter) bufferedRequests() ([]string, error) {
+	entries, err := os.ReadDir(w.config.BufferPath)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), remoteWriteBufferSuffix) && !strings.HasPrefix(entry.Name(), ".") {
+			names = append(names, entry.Name())
+		}
+	}
+	// the names are nanosecond timestamps of the same length, so they sort by time
+	sort.Strings(names)
+	return names, nil
+}
+
+// trimBuffer drops the oldest buffered requests beyond BufferMaxSize
+func (w *RemoteWriter) trimBuffer() {
+	if w.config.BufferMaxSize <= 0 {
+		return
+	}
+	names, err := w.bufferedRequests()
+	if err != nil {
+		log.Errorf("error reading the remote write buffer: %s", err.Error())
+		return
+	}
+	sizes := make([]int64, len(names))
+	var total int64
+	for i, name := range names {
+		if info, err := os.Stat(filepath.Join(w.config.BufferPath, name)); err == nil {
+			sizes[i] = info.Size()
+			total += sizes[i]
+		}
+	}
+	dropped := 0
+	for i := 0; i < len(names) && total > w.config.BufferMaxSize; i++ {
+		os.Remove(filepath.Join(w.config.BufferPath, names[i]))
+		total -= sizes[i]
+		dropped++
+	}
+	if dropped > 0 {
+		log.Errorf("remote write buffer is full, dropped the %d oldest requests", dropped)
+	}
+}
+
+// flushBuffer sends the buffered requests oldest first and stops at the first one that fails
+func (w *RemoteWriter) flushBuffer(now time.Time) error {
+	if w.config.BufferPath == "" {
+		return nil
+	}
+	names, err := w.bufferedRequests()
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		path := filepath.Join(w.config.BufferPath, name)
+		nanos, _ := strconv.ParseInt(strings.TrimSuffix(name, remoteWriteBufferSuffix), 10, 64)
+		if now.Sub(time.Unix(0, nanos)) > w.config.BufferRetention {
+			os.Remove(path)
+			continue
+		}
+		request, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if err := w.send(request); err != nil {
+			if _, ok := err.(*remoteWriteError); !ok {
+				return err
+			}
+			log.Errorf("dropping buffered remote write request: %s", err.Error())
+		}
+		os.Remove(path)
+	}
+	return nil
+}
+
+func (w *RemoteWriter) send(request []byte) error {
+	httpRequest, err := http.NewRequest(http.MethodPost, w.config.URL, bytes.NewReader(request))
+	if err != nil {
+		return err
+	}
+	httpRequest.Header.Set("Content-Encoding", "snappy")
+	httpRequest.Header.Set("Content-Type", "application/x-protobuf")
+	httpRequest.Header.Set("User-Agent", "fibertel-station-exporter")
+	httpRequest.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	switch {
+	case w.config.BearerToken != "":
+		httpRequest.Header.Set("Authorization", "Bearer "+w.config.BearerToken)
+	case w.config.Username != "":
+		httpRequest.SetBasicAuth(w.config.Username, w.config.Password)
+	}
+	response, err := w.client.Do(httpRequest)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	message, _ := io.ReadAll(io.LimitReader(response.Body, 1024))
+	switch {
+	case response.StatusCode >= 200 && response.StatusCode < 300:
+		return nil
+	// 429 asks to back off, the request is accepted later
+	case response.StatusCode >= 400 && response.StatusCode < 500 && response.StatusCode != http.StatusTooManyRequests:
+		return &remoteWriteError{response.Status, strings.TrimSpace(string(message))}
+	}
+	return fmt.Errorf("remote write receiver responded %s: %s", response.Status, strings.TrimSpace(string(message)))
+}
+
+// encodeWriteRequest builds a remote write WriteRequest with one sample per series
+func encodeWriteRequest(families []*dto.MetricFamily, externalLabels map[string]string, now time.Time) []byte {
+	request := &protoBuffer{}
+	for _, family := range families {
+		for _, metric := range family.Metric {
+			var value float64
+			switch {
+			case metric.Gauge != nil:
+				value = metric.Gauge.GetValue()
+			case metric.Counter != nil:
+				value = metric.Counter.GetValue()
+			case metric.Untyped != nil:
+				value = metric.Untyped.GetValue()
+			default:
+				continue
+			}
+			timestamp := now.UnixNano() / int64(time.Millisecond)
+			if metric.TimestampMs != nil {
+				timestamp = metric.GetTimestampMs()
+			}
+
+			labels := map[string]string{"__name__": family.GetName()}
+			for name, value := range externalLabels {
+				labels[name] = value
+			}
+			for _, label := range metric.Label {
+				labels[label.GetName()] = label.GetValue()
+			}
+			names := make([]string, 0, len(labels))
+			for name, value := range labels {
+				if value != "" {
+					names = append(names, name)
+				}
+			}
+			// receivers expect the labels sorted by name
+			sort.Strings(names)
+
+			request.message(1, func(series *protoBuffer) {
+				for _, name := range names {
+					series.message(1, func(label *protoBuffer) {
+						label.string(1, name)
+						label.string(2, labels[name])
+					})
+				}
+				series.message(2, func(sample *protoBuffer) {
+					sample.double(1, value)
+					sample.int64(2, timestamp)
+				})
+			})
+		}
+	}
+	return request.Bytes()
+}
@@ -0,0 +1,147 @@
+package collector_test
+
+import (
+	"github.com/golang/snappy"
+	"github.com/reynico/fibertel-station-exporter/collector"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+type remoteWriteSample struct {
+	labels    map[string]string
+	value     float64
+	timestamp int64
+}
+
+func decodeWriteRequest(t *testing.T, body []byte) []*remoteWriteSample {
+	request, err := snappy.Decode(nil, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var samples []*remoteWriteSample
+	for _, series := range decodeProto(t, request)[1] {
+		fields := decodeProto(t, series.bytes)
+		sample := &remoteWriteSample{labels: make(map[string]string)}
+		for _, label := range fields[1] {
+			labelFields := decodeProto(t, label.bytes)
+			sample.labels[string(labelFields[1][0].bytes)] = string(labelFields[2][0].bytes)
+		}
+		sampleFields := decodeProto(t, fields[2][0].bytes)
+		sample.value = math.Float64frombits(sampleFields[1][0].value)
+		sample.timestamp = int64(sampleFields[2][0].value)
+		samples = append(samples, sample)
+	}
+	return samples
+}
+
+func TestRemoteWriter(t *testing.T) {
+	requests := make(chan []*remoteWriteSample, 10)
+	down := true
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		if r.Header.Get("Content-Encoding") != "snappy" || r.Header.Get("Authorization") != "Bearer s3cret" {
+			t.Errorf("unexpected headers %+v", r.Header)
+		}
+		body, _ := io.ReadAll(r.Body)
+		requests <- decodeWriteRequest(t, body)
+	}))
+	defer receiver.Close()
+
+	families, err := gatherTestStation(t).Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := collector.DefaultRemoteWriteConfig()
+	config.URL = receiver.URL
+	config.BearerToken = "s3cret"
+	config.ExternalLabels = map[string]string{"home": "grandma"}
+	config.BufferPath = filepath.Join(t.TempDir(), "buffer")
+	writer, err := collector.NewRemoteWriter(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the samples of polls during an outage are buffered and sent in order once it's over
+	now := time.Now()
+	for i := 0; i < 2; i++ {
+		if err := writer.Push(families, now.Add(time.Duration(i)*time.Minute)); err == nil {
+			t.Errorf("expected an error while the receiver is down")
+		}
+	}
+	if buffered, _ := os.ReadDir(config.BufferPath); len(buffered) != 2 {
+		t.Fatalf("expected 2 buffered requests, got %d", len(buffered))
+	}
+	down = false
+	if err := writer.Push(families, now.Add(2*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	close(requests)
+	var timestamps []int64
+	for samples := range requests {
+		var snr *remoteWriteSample
+		for _, sample := range samples {
+			if sample.labels["__name__"] == "fibertel_downstream_snr_dB" && sample.labels["channel_id"] == "2" {
+				snr = sample
+			}
+		}
+		if snr == nil || snr.value != 31.2 || snr.labels["home"] != "grandma" {
+			t.Fatalf("expected the downstream SNR with the external labels, got %+v", snr)
+		}
+		timestamps = append(timestamps, snr.timestamp)
+	}
+	if len(timestamps) != 3 || timestamps[0] != now.UnixNano()/1e6 || timestamps[1] != timestamps[0]+60000 || timestamps[2] != timestamps[0]+120000 {
+		t.Errorf("expected the buffered samples first, got timestamps %v", timestamps)
+	}
+	if buffered, _ := os.ReadDir(config.BufferPath); len(buffered) != 0 {
+		t.Errorf("expected the buffer to be empty, got %d requests", len(buffered))
+	}
+}
+
+func TestRemoteWriterBufferMaxSize(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer receiver.Close()
+
+	families, err := gatherTestStation(t).Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := collector.DefaultRemoteWriteConfig()
+	config.URL = receiver.URL
+	config.BufferPath = filepath.Join(t.TempDir(), "buffer")
+	writer, err := collector.NewRemoteWriter(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	writer.Push(families, now)
+	buffered, _ := os.ReadDir(config.BufferPath)
+	if len(buffered) != 1 {
+		t.Fatalf("expected 1 buffered request, got %d", len(buffered))
+	}
+	info, _ := buffered[0].Info()
+
+	// room for two requests, the oldest are dropped beyond that
+	config.BufferMaxSize = 2*info.Size() + info.Size()/2
+	for i := 1; i < 4; i++ {
+		writer.Push(families, now.Add(time.Duration(i)*time.Minute))
+	}
+	buffered, _ = os.ReadDir(config.BufferPath)
+	if len(buffered) != 2 {
+		t.Fatalf("expected 2 buffered requests, got %d", len(buffered))
+	}
+	if newest := strconv.FormatInt(now.Add(3*time.Minute).UnixNano(), 10) + ".snappy"; buffered[1].Name() != newest {
+		t.Errorf("expected the newest requests to be kept, got %s and %s", buffered[0].Name(), buffered[1].Name())
+	}
+}
@@ -0,0 +1,338 @@
+package collector
+
+import (
+	"github.com/prometheus/common/log"
+	htmltemplate "html/template"
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const redacted = "[redacted]"
+
+var (
+	macAddressRegex  = regexp.MustCompile(`\b([0-9a-fA-F]{2}[:-]){5}[0-9a-fA-F]{2}\b`)
+	ipv4AddressRegex = regexp.MustCompile(`\b([0-9]{1,3}\.){3}[0-9]{1,3}\b`)
+
+	// layouts the gateway uses for event log timestamps
+	eventTimeLayouts = []string{
+		"02/01/2006 15:04:05",
+		"2006-01-02 15:04:05",
+		"2006-01-02T15:04:05",
+		time.ANSIC,
+	}
+)
+
+// ReportOptions select what goes into a support report
+type ReportOptions struct {
+	// Period is how far back event log errors and outages are included
+	Period time.Duration
+	// Profile holds the thresholds channels are graded against, nil means DefaultThresholdProfile
+	Profile *ThresholdProfile
+	// Outages are the locally recorded outages, nil leaves them out of the report
+	Outages *OutageTracker
+}
+
+// Report is a snapshot of the line to attach to an ISP support ticket
+type Report struct {
+	Generated time.Time         `json:"generated"`
+	Since     time.Time         `json:"since"`
+	Gateway   string            `json:"gateway"`
+	System    *SystemInfoData   `json:"system"`
+	Summary   *LineSummary      `json:"summary"`
+	Health    *LineHealth       `json:"health"`
+	Channels  []*ReportChannel  `json:"channels"`
+	Events    []*EventLogRecord `json:"events"`
+	Outages   []*Outage         `json:"outages"`
+}
+
+// ReportChannel is a row of the channel tables, graded with the worst grade of its checks
+type ReportChannel struct {
+	Direction  string `json:"direction"`
+	ChannelId  string `json:"channel_id"`
+	Frequency  string `json:"frequency"`
+	Modulation string `json:"modulation"`
+	Power      string `json:"power"`
+	Snr        string `json:"snr"`
+	Locked     string `json:"locked"`
+	Grade      Grade  `json:"grade"`
+}
+
+// Result returns pass, marginal or fail
+func (c *ReportChannel) Result() string {
+	switch c.Grade {
+	case Good:
+		return "pass"
+	case Marginal:
+		return "marginal"
+	}
+	return "fail"
+}
+
+// BuildReport logs into the gateway once and collects everything that goes into a report
+func BuildReport(station *FibertelStation, options ReportOptions) (*Report, error) {
+	if _, err := station.Login(); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if _, err := station.Logout(); err != nil {
+			log.Errorf("error logging out: %s", err.Error())
+		}
+	}()
+
+	now := time.Now()
+	report := &Report{Generated: now, Since: now.Add(-options.Period), Gateway: station.URL, System: &SystemInfoData{}}
+	// older firmwares don't serve the system information, the rest of the report is still useful
+	if systemInfoResponse, err := station.GetSystemInfo(); err != nil {
+		log.Errorf("error getting system information: %s", err.Error())
+	} else if systemInfoResponse.Data != nil {
+		report.System = systemInfoResponse.Data
+	}
+
+	modemStatusResponse, err := station.GetModemStatus()
+	if err != nil {
+		return nil, err
+	}
+	data := modemStatusResponse.Data
+	if data == nil {
+		data = &ModemStatusData{}
+	}
+	report.Summary = Summarize(data)
+	report.Health = EvaluateHealth(data, options.Profile)
+	report.Channels = reportChannels(data, report.Health)
+
+	eventLogResponse, err := station.GetEventLog()
+	if err != nil {
+		log.Errorf("error getting event log: %s", err.Error())
+	} else if eventLogResponse.Data != nil {
+		report.Events = reportEvents(NewEventLog().Update(eventLogResponse.Data.Entries), report.Since)
+	}
+
+	if options.Outages != nil {
+		report.Outages = options.Outages.Outages(report.Since)
+	}
+	return report, nil
+}
+
+func reportChannels(data *ModemStatusData, health *LineHealth) []*ReportChannel {
+	grades := make(map[string]Grade)
+	for _, check := range health.Channels {
+		key := check.Direction + "/" + check.ChannelId
+		if check.Grade > grades[key] {
+			grades[key] = check.Grade
+		}
+	}
+	var channels []*ReportChannel
+	add := func(channel *ReportChannel) {
+		channel.Grade = grades[channel.Direction+"/"+channel.ChannelId]
+		channels = append(channels, channel)
+	}
+	for _, channel := range data.Downstream {
+		add(&ReportChannel{DirectionDownstream, channel.ChannelId, channel.CentralFrequency, channel.Modulation, channel.Power, channel.Snr, channel.Locked, Good})
+	}
+	for _, channel := range data.OfdmDownstreamData {
+		add(&ReportChannel{DirectionOfdmDownstream, channel.ChannelIdOfdm, channel.CentralFrequencyOfdm, channel.FftOfdm, channel.PowerOfdm, channel.SnrOfdm, channel.LockedOfdm, Good})
+	}
+	for _, channel := range data.Upstream {
+		add(&ReportChannel{DirectionUpstream, channel.ChannelIdUp, channel.CentralFrequency, channel.Modulation, channel.Power, "", channel.Locked, Good})
+	}
+	for _, channel := range data.OfdmUpstreamData {
+		add(&ReportChannel{DirectionOfdmUpstream, channel.ChannelIdOfdm, channel.CentralFrequencyOfdm, channel.FftOfdm, channel.PowerOfdm, "", channel.LockedOfdm, Good})
+	}
+	return channels
+}
+
+// reportEvents keeps the errors of the period, newest first. Entries logged before the gateway
+// got the time of day carry bogus timestamps and are kept, as they are usually the interesting ones.
+func reportEvents(records []*EventLogRecord, since time.Time) []*EventLogRecord {
+	events := []*EventLogRecord{}
+	for i := len(records) - 1; i >= 0; i-- {
+		record := records[i]
+		switch recordSeverity(record) {
+		case "emergency", "alert", "critical", "error":
+		default:
+			continue
+		}
+		if eventTime, ok := parseEventTime(record.Time); ok && eventTime.Before(since) {
+			continue
+		}
+		events = append(events, record)
+	}
+	return events
+}
+
+func parseEventTime(str string) (time.Time, bool) {
+	for _, layout := range eventTimeLayouts {
+		eventTime, err := time.ParseInLocation(layout, strings.TrimSpace(str), time.Local)
+		if err == nil && eventTime.Year() >= 2000 {
+			return eventTime, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// Redact removes the serial number, MAC and IP addresses and the gateway URL from the report
+func (r *Report) Redact() {
+	system := *r.System
+	if system.SerialNumber != "" {
+		system.SerialNumber = redacted
+	}
+	if system.MacAddress != "" {
+		system.MacAddress = redacted
+	}
+	r.System = &system
+	if parsedUrl, err := url.Parse(r.Gateway); err == nil && parsedUrl.Scheme != "" {
+		r.Gateway = parsedUrl.Scheme + "://" + redacted
+	} else {
+		r.Gateway = redacted
+	}
+	events := make([]*EventLogRecord, len(r.Events))
+	for i, event := range r.Events {
+		copied := *event
+		copied.Text = ipv4AddressRegex.ReplaceAllString(macAddressRegex.ReplaceAllString(copied.Text, redacted), redacted)
+		events[i] = &copied
+	}
+	r.Events = events
+}
+
+var reportFuncs = map[string]interface{}{
+	"time": func(t time.Time) string {
+		return t.Format("2006-01-02 15:04:05 MST")
+	},
+	"outageEnd": func(outage *Outage) string {
+		if outage.End == nil {
+			return "ongoing"
+		}
+		return outage.End.Format("2006-01-02 15:04:05 MST")
+	},
+	"outageDuration": func(outage *Outage, now time.Time) string {
+		return outage.Duration(now).Round(time.Second).String()
+	},
+	"severity": recordSeverity,
+	"cell": func(str string) string {
+		return strings.NewReplacer("|", "\\|", "\n", " ").Replace(str)
+	},
+}
+
+const reportMarkdownTemplate = `# Fibertel line report
+
+Generated {{ time .Generated }} for {{ .Gateway }}, covering the period since {{ time .Since }}.
+
+## Gateway
+
+| | |
+|---|---|
+| Model | {{ cell .System.ModelName }} |
+| Firmware | {{ cell .System.SoftwareVersion }} |
+| Hardware | {{ cell .System.HardwareVersion }} |
+| Serial number | {{ cell .System.SerialNumber }} |
+| CM MAC address | {{ cell .System.MacAddress }} |
+| Uptime | {{ cell .System.UpTime }} |
+
+## Summary
+
+| Direction | Locked channels | Power min/avg/max (dBmV) | SNR min/avg/max (dB) |
+|---|---|---|---|
+| Downstream | {{ .Summary.Downstream.LockedChannels }}/{{ .Summary.Downstream.Channels }} | {{ printf "%.1f / %.1f / %.1f" .Summary.Downstream.PowerMin .Summary.Downstream.PowerAvg .Summary.Downstream.PowerMax }} | {{ printf "%.1f / %.1f / %.1f" .Summary.Downstream.SnrMin .Summary.Downstream.SnrAvg .Summary.Downstream.SnrMax }} |
+| Upstream | {{ .Summary.Upstream.LockedChannels }}/{{ .Summary.Upstream.Channels }} | {{ printf "%.1f / %.1f / %.1f" .Summary.Upstream.PowerMin .Summary.Upstream.PowerAvg .Summary.Upstream.PowerMax }} | |
+
+Line health score: {{ printf "%.0f" .Health.Score }}/100 ({{ .Health.Overall }})
+
+## Channels
+
+| Direction | Channel | Frequency | Modulation | Power | SNR | Lock | Result |
+|---|---|---|---|---|---|---|---|
+{{ range .Channels }}| {{ .Direction }} | {{ cell .ChannelId }} | {{ cell .Frequency }} | {{ cell .Modulation }} | {{ cell .Power }} | {{ cell .Snr }} | {{ cell .Locked }} | {{ .Result }} |
+{{ end }}
+## Event log errors
+
+{{ if .Events }}| Time | Severity | Event | Text |
+|---|---|---|---|
+{{ range .Events }}| {{ cell .Time }} | {{ severity . }} | {{ .EventId }} | {{ cell .Text }} |
+{{ end }}{{ else }}No errors in the event log.
+{{ end }}
+## Outages
+
+{{ $now := .Generated }}{{ if .Outages }}| Start | End | Duration | Cause |
+|---|---|---|---|
+{{ range .Outages }}| {{ time .Start }} | {{ outageEnd . }} | {{ outageDuration . $now }} | {{ .Cause }} |
+{{ end }}{{ else }}No outages recorded.
+{{ end }}`
+
+const reportHTMLTemplate = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Fibertel line report</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left; }
+th { background: #eee; }
+.pass { background: #d4edda; }
+.marginal { background: #fff3cd; }
+.fail { background: #f8d7da; }
+</style>
+</head>
+<body>
+<h1>Fibertel line report</h1>
+<p>Generated {{ time .Generated }} for {{ .Gateway }}, covering the period since {{ time .Since }}.</p>
+
+<h2>Gateway</h2>
+<table>
+<tr><th>Model</th><td>{{ .System.ModelName }}</td></tr>
+<tr><th>Firmware</th><td>{{ .System.SoftwareVersion }}</td></tr>
+<tr><th>Hardware</th><td>{{ .System.HardwareVersion }}</td></tr>
+<tr><th>Serial number</th><td>{{ .System.SerialNumber }}</td></tr>
+<tr><th>CM MAC address</th><td>{{ .System.MacAddress }}</td></tr>
+<tr><th>Uptime</th><td>{{ .System.UpTime }}</td></tr>
+</table>
+
+<h2>Summary</h2>
+<table>
+<tr><th>Direction</th><th>Locked channels</th><th>Power min/avg/max (dBmV)</th><th>SNR min/avg/max (dB)</th></tr>
+<tr><td>Downstream</td><td>{{ .Summary.Downstream.LockedChannels }}/{{ .Summary.Downstream.Channels }}</td><td>{{ printf "%.1f / %.1f / %.1f" .Summary.Downstream.PowerMin .Summary.Downstream.PowerAvg .Summary.Downstream.PowerMax }}</td><td>{{ printf "%.1f / %.1f / %.1f" .Summary.Downstream.SnrMin .Summary.Downstream.SnrAvg .Summary.Downstream.SnrMax }}</td></tr>
+<tr><td>Upstream</td><td>{{ .Summary.Upstream.LockedChannels }}/{{ .Summary.Upstream.Channels }}</td><td>{{ printf "%.1f / %.1f / %.1f" .Summary.Upstream.PowerMin .Summary.Upstream.PowerAvg .Summary.Upstream.PowerMax }}</td><td></td></tr>
+</table>
+<p>Line health score: {{ printf "%.0f" .Health.Score }}/100 ({{ .Health.Overall }})</p>
+
+<h2>Channels</h2>
+<table>
+<tr><th>Direction</th><th>Channel</th><th>Frequency</th><th>Modulation</th><th>Power</th><th>SNR</th><th>Lock</th><th>Result</th></tr>
+{{ range .Channels }}<tr class="{{ .Result }}"><td>{{ .Direction }}</td><td>{{ .ChannelId }}</td><td>{{ .Frequency }}</td><td>{{ .Modulation }}</td><td>{{ .Power }}</td><td>{{ .Snr }}</td><td>{{ .Locked }}</td><td>{{ .Result }}</td></tr>
+{{ end }}</table>
+
+<h2>Event log errors</h2>
+{{ if .Events }}<table>
+<tr><th>Time</th><th>Severity</th><th>Event</th><th>Text</th></tr>
+{{ range .Events }}<tr><td>{{ .Time }}</td><td>{{ severity . }}</td><td>{{ .EventId }}</td><td>{{ .Text }}</td></tr>
+{{ end }}</table>
+{{ else }}<p>No errors in the event log.</p>
+{{ end }}
+<h2>Outages</h2>
+{{ $now := .Generated }}{{ if .Outages }}<table>
+<tr><th>Start</th><th>End</th><th>Duration</th><th>Cause</th></tr>
+{{ range .Outages }}<tr><td>{{ time .Start }}</td><td>{{ outageEnd . }}</td><td>{{ outageDuration . $now }}</td><td>{{ .Cause }}</td></tr>
+{{ end }}</table>
+{{ else }}<p>No outages recorded.</p>
+{{ end }}</body>
+</html>
+`
+
+var (
+	reportMarkdown = template.Must(template.New("report").Funcs(reportFuncs).Parse(reportMarkdownTemplate))
+	reportHTML     = htmltemplate.Must(htmltemplate.New("report").Funcs(reportFuncs).Parse(reportHTMLTemplate))
+)
+
+// WriteMarkdown renders the report as Markdown
+func (r *Report) WriteMarkdown(w io.Writer) error {
+	return reportMarkdown.Execute(w, r)
+}
+
+// WriteHTML renders the report as a self-contained HTML page
+func (r *Report) WriteHTML(w io.Writer) error {
+	return reportHTML.Execute(w, r)
+}
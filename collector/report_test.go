@@ -0,0 +1,63 @@
+package collector_test
+
+import (
+	"bytes"
+	"github.com/reynico/fibertel-station-exporter/collector"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildReport(t *testing.T) {
+	station := newTestStation(t, newTestModemStatusData())
+	outages, _ := collector.NewOutageTracker("")
+	outages.Observe(collector.OutageDownstreamUnlocked, time.Now().Add(-2*time.Hour))
+	outages.Observe("", time.Now().Add(-time.Hour))
+
+	report, err := collector.BuildReport(collector.NewFibertelStation(station.URL, "custadmin", "password"), collector.ReportOptions{Period: 24 * time.Hour, Outages: outages})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.System.SoftwareVersion != "CGA4233TCH3-1.0.5" {
+		t.Errorf("expected the firmware version, got %q", report.System.SoftwareVersion)
+	}
+	if len(report.Events) != 1 || report.Events[0].EventId != "82000200" {
+		t.Errorf("expected only the T3 time-out error, got %+v", report.Events)
+	}
+	if len(report.Outages) != 1 {
+		t.Errorf("expected 1 outage, got %d", len(report.Outages))
+	}
+	results := make(map[string]string)
+	for _, channel := range report.Channels {
+		results[channel.Direction+"/"+channel.ChannelId] = channel.Result()
+	}
+	expected := map[string]string{
+		"downstream/1": "pass",
+		"downstream/2": "marginal",
+		"downstream/4": "fail",
+	}
+	for key, result := range expected {
+		if results[key] != result {
+			t.Errorf("expected %s to be %s, got %q", key, result, results[key])
+		}
+	}
+
+	report.Redact()
+	var markdown, html bytes.Buffer
+	if err := report.WriteMarkdown(&markdown); err != nil {
+		t.Fatal(err)
+	}
+	if err := report.WriteHTML(&html); err != nil {
+		t.Fatal(err)
+	}
+	for _, output := range []string{markdown.String(), html.String()} {
+		if !strings.Contains(output, "CGA4233TCH3-1.0.5") || !strings.Contains(output, "82000200") {
+			t.Errorf("expected the firmware and the event in the report, got %s", output)
+		}
+		for _, sensitive := range []string{"CP1234SA5678", "a4:91:b1:00:11:22", "00:17:10:aa:bb:cc", station.URL} {
+			if strings.Contains(output, sensitive) {
+				t.Errorf("expected %s to be redacted", sensitive)
+			}
+		}
+	}
+}
@@ -0,0 +1,359 @@
+package collector
+
+import (
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+	"github.com/prometheus/common/model"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var ruleStateDesc *prometheus.Desc
+
+func init() {
+	ruleStateDesc = prometheus.NewDesc(prefix+"rule_state", "State of an alert rule: 0 = inactive, 1 = pending, 2 = firing", []string{"rule"}, nil)
+}
+
+// Rule states
+const (
+	RuleInactive = iota
+	RulePending
+	RuleFiring
+)
+
+// resolved alerts are served for this long, so tools polling the alerts see them resolve
+const resolvedAlertRetention = 15 * time.Minute
+
+// firing alerts end this many evaluation intervals after their last evaluation, like Prometheus
+// does, so they resolve by themselves if the exporter stops evaluating
+const (
+	firingAlertIntervals     = 4
+	minAlertEvaluateInterval = time.Minute
+)
+
+var (
+	ruleExprRegex = regexp.MustCompile(`^\s*(downstream|upstream|ofdm_downstream|ofdm_upstream)\.([a-z_]+)\s*(<=|>=|==|!=|<|>)\s*(-?[0-9]+(?:\.[0-9]+)?)\s*(?:for\s+([0-9a-z.]+))?\s*$`)
+
+	// channelRuleFields are evaluated for every locked channel, directionRuleFields once per direction
+	channelRuleFields   = map[string]bool{"power": true, "snr": true, "locked": true}
+	directionRuleFields = map[string]bool{"channels": true, "locked_channels": true}
+)
+
+// RuleConfig is an alert rule of the configuration file
+type RuleConfig struct {
+	// Name of the rule, defaults to the expression
+	Name string `yaml:"name"`
+	// Expr is the condition, e.g. "downstream.snr < 33 for 10m"
+	Expr     string `yaml:"expr"`
+	Severity string `yaml:"severity"`
+	Summary  string `yaml:"summary"`
+}
+
+// Alert is an alert in the format of the Alertmanager v2 API. Like in Alertmanager, an alert is
+// resolved once its EndsAt has passed.
+type Alert struct {
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations"`
+	StartsAt     time.Time         `json:"startsAt"`
+	EndsAt       time.Time         `json:"endsAt"`
+	UpdatedAt    time.Time         `json:"updatedAt"`
+	GeneratorURL string            `json:"generatorURL,omitempty"`
+	Fingerprint  string            `json:"fingerprint"`
+	Receivers    []*AlertReceiver  `json:"receivers"`
+	Status       AlertStatus       `json:"status"`
+}
+
+type AlertReceiver struct {
+	Name string `json:"name"`
+}
+
+// AlertStatus is always active, as there's neither silencing nor inhibition
+type AlertStatus struct {
+	State       string   `json:"state"`
+	SilencedBy  []string `json:"silencedBy"`
+	InhibitedBy []string `json:"inhibitedBy"`
+}
+
+// rule is a parsed alert rule along with the state of its instances, one per channel for
+// channel fields and a single one for direction fields
+type rule struct {
+	config    *RuleConfig
+	name      string
+	direction string
+	field     string
+	operator  string
+	threshold float64
+	duration  time.Duration
+	instances map[string]*ruleInstance
+}
+
+type ruleInstance struct {
+	channelId  string
+	value      float64
+	activeAt   time.Time
+	firingAt   time.Time
+	resolvedAt time.Time
+	updatedAt  time.Time
+}
+
+func (i *ruleInstance) state() int {
+	switch {
+	case !i.resolvedAt.IsZero():
+		return RuleInactive
+	case !i.firingAt.IsZero():
+		return RuleFiring
+	}
+	return RulePending
+}
+
+// RuleEngine evaluates threshold rules on the polled modem status, for setups without Prometheus
+type RuleEngine struct {
+	mu    sync.Mutex
+	rules []*rule
+	// lastEvaluation and interval are the time of and since the previous evaluation
+	lastEvaluation time.Time
+	interval       time.Duration
+}
+
+func NewRuleEngine(configs []*RuleConfig) (*RuleEngine, error) {
+	engine := &RuleEngine{}
+	names := make(map[string]bool)
+	for _, config := range configs {
+		parsed, err := parseRule(config)
+		if err != nil {
+			return nil, err
+		}
+		if names[parsed.name] {
+			return nil, fmt.Errorf("duplicate rule %q", parsed.name)
+		}
+		names[parsed.name] = true
+		engine.rules = append(engine.rules, parsed)
+	}
+	return engine, nil
+}
+
+func parseRule(config *RuleConfig) (*rule, error) {
+	match := ruleExprRegex.FindStringSubmatch(config.Expr)
+	if match == nil {
+		return nil, fmt.Errorf("invalid rule %q, expected e.g. \"downstream.snr < 33 for 10m\"", config.Expr)
+	}
+	parsed := &rule{
+		config:    config,
+		name:      config.Name,
+		direction: match[1],
+		field:     match[2],
+		operator:  match[3],
+		instances: make(map[string]*ruleInstance),
+	}
+	if parsed.name == "" {
+		parsed.name = config.Expr
+	}
+	if !channelRuleFields[parsed.field] && !directionRuleFields[parsed.field] {
+		return nil, fmt.Errorf("invalid rule %q, unknown field %q, expected power, snr, locked, channels or locked_channels", config.Expr, parsed.field)
+	}
+	if parsed.field == "snr" && (parsed.direction == DirectionUpstream || parsed.direction == DirectionOfdmUpstream) {
+		return nil, fmt.Errorf("invalid rule %q, the gateway doesn't report the upstream SNR", config.Expr)
+	}
+	parsed.threshold, _ = strconv.ParseFloat(match[4], 64)
+	if match[5] != "" {
+		var err error
+		if parsed.duration, err = time.ParseDuration(match[5]); err != nil {
+			return nil, fmt.Errorf("invalid rule %q: %s", config.Expr, err.Error())
+		}
+	}
+	return parsed, nil
+}
+
+func (r *rule) matches(value float64) bool {
+	switch r.operator {
+	case "<":
+		return value < r.threshold
+	case "<=":
+		return value <= r.threshold
+	case ">":
+		return value > r.threshold
+	case ">=":
+		return value >= r.threshold
+	case "==":
+		return value == r.threshold
+	}
+	return value != r.threshold
+}
+
+// values returns the value of the rule's field per channel id, or for direction fields a single
+// value with an empty channel id. Power and SNR of unlocked channels are meaningless and skipped.
+func (r *rule) values(data *ModemStatusData) map[string]float64 {
+	type channel struct {
+		id, power, snr string
+		locked         bool
+	}
+	var channels []channel
+	switch r.direction {
+	case DirectionDownstream:
+		for _, c := range data.Downstream {
+			channels = append(channels, channel{c.ChannelId, c.Power, c.Snr, c.Locked == "Locked"})
+		}
+	case DirectionOfdmDownstream:
+		for _, c := range data.OfdmDownstreamData {
+			channels = append(channels, channel{c.ChannelIdOfdm, c.PowerOfdm, c.SnrOfdm, c.LockedOfdm == "Locked"})
+		}
+	case DirectionUpstream:
+		for _, c := range data.Upstream {
+			channels = append(channels, channel{c.ChannelIdUp, c.Power, "", c.Locked == "Locked"})
+		}
+	case DirectionOfdmUpstream:
+		for _, c := range data.OfdmUpstreamData {
+			channels = append(channels, channel{c.ChannelIdOfdm, c.PowerOfdm, "", c.LockedOfdm == "Locked"})
+		}
+	}
+
+	values := make(map[string]float64)
+	if directionRuleFields[r.field] {
+		locked := 0
+		for _, c := range channels {
+			if c.locked {
+				locked++
+			}
+		}
+		values[""] = float64(len(channels))
+		if r.field == "locked_channels" {
+			values[""] = float64(locked)
+		}
+		return values
+	}
+	for _, c := range channels {
+		switch {
+		case r.field == "locked":
+			values[c.id] = bool2float64(c.locked)
+		case !c.locked:
+		case r.field == "power":
+			values[c.id] = parse2float(c.power)
+		case r.field == "snr":
+			values[c.id] = parse2float(c.snr)
+		}
+	}
+	return values
+}
+
+// Evaluate moves the rule instances along their pending, firing and resolved lifecycle
+func (e *RuleEngine) Evaluate(data *ModemStatusData, now time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if !e.lastEvaluation.IsZero() && now.After(e.lastEvaluation) {
+		e.interval = now.Sub(e.lastEvaluation)
+	}
+	e.lastEvaluation = now
+	for _, r := range e.rules {
+		values := r.values(data)
+		for channelId, value := range values {
+			if !r.matches(value) {
+				continue
+			}
+			instance := r.instances[channelId]
+			if instance == nil || instance.state() == RuleInactive {
+				instance = &ruleInstance{channelId: channelId, activeAt: now}
+				r.instances[channelId] = instance
+			}
+			instance.value = value
+			instance.updatedAt = now
+			if instance.firingAt.IsZero() && now.Sub(instance.activeAt) >= r.duration {
+				instance.firingAt = now
+				log.Infof("Rule %q is firing (value %g)", r.name, value)
+			}
+		}
+		for channelId, instance := range r.instances {
+			value, ok := values[channelId]
+			switch {
+			case ok && r.matches(value):
+			case instance.state() == RulePending:
+				delete(r.instances, channelId)
+			case instance.state() == RuleFiring:
+				instance.resolvedAt = now
+				instance.updatedAt = now
+				log.Infof("Rule %q is resolved", r.name)
+			case now.Sub(instance.resolvedAt) > resolvedAlertRetention:
+				delete(r.instances, channelId)
+			}
+		}
+	}
+}
+
+// Alerts returns the firing and recently resolved alerts in the Alertmanager v2 format
+func (e *RuleEngine) Alerts() []*Alert {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	interval := e.interval
+	if interval < minAlertEvaluateInterval {
+		interval = minAlertEvaluateInterval
+	}
+	alerts := []*Alert{}
+	for _, r := range e.rules {
+		for _, instance := range r.instances {
+			if instance.firingAt.IsZero() {
+				continue
+			}
+			labels := model.LabelSet{"alertname": model.LabelValue(r.name), "direction": model.LabelValue(r.direction)}
+			if instance.channelId != "" {
+				labels["channel_id"] = model.LabelValue(instance.channelId)
+			}
+			if r.config.Severity != "" {
+				labels["severity"] = model.LabelValue(r.config.Severity)
+			}
+			alert := &Alert{
+				Labels:      make(map[string]string, len(labels)),
+				Annotations: map[string]string{"value": strconv.FormatFloat(instance.value, 'f', -1, 64), "expr": r.config.Expr},
+				StartsAt:    instance.firingAt,
+				EndsAt:      instance.resolvedAt,
+				UpdatedAt:   instance.updatedAt,
+				Fingerprint: labels.Fingerprint().String(),
+				Receivers:   []*AlertReceiver{},
+				Status:      AlertStatus{State: "active", SilencedBy: []string{}, InhibitedBy: []string{}},
+			}
+			for name, value := range labels {
+				alert.Labels[string(name)] = string(value)
+			}
+			if r.config.Summary != "" {
+				alert.Annotations["summary"] = r.config.Summary
+			}
+			if instance.resolvedAt.IsZero() {
+				alert.EndsAt = instance.updatedAt.Add(firingAlertIntervals * interval)
+			}
+			alerts = append(alerts, alert)
+		}
+	}
+	sort.Slice(alerts, func(i, j int) bool {
+		return alerts[i].Fingerprint < alerts[j].Fingerprint
+	})
+	return alerts
+}
+
+func (e *RuleEngine) collect(ch chan<- prometheus.Metric) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, r := range e.rules {
+		state := RuleInactive
+		for _, instance := range r.instances {
+			if instance.state() > state {
+				state = instance.state()
+			}
+		}
+		ch <- prometheus.MustNewConstMetric(ruleStateDesc, prometheus.GaugeValue, float64(state), r.name)
+	}
+}
+
+func (c *Collector) collectRules(ch chan<- prometheus.Metric, data *ModemStatusData) {
+	if c.Rules == nil {
+		return
+	}
+	if data != nil {
+		c.Rules.Evaluate(data, time.Now())
+	}
+	c.Rules.collect(ch)
+}
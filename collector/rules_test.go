@@ -0,0 +1,154 @@
+package collector_test
+
+import (
+	"encoding/json"
+	"github.com/reynico/fibertel-station-exporter/collector"
+	"testing"
+	"time"
+)
+
+func TestRuleEngine(t *testing.T) {
+	engine, err := collector.NewRuleEngine([]*collector.RuleConfig{
+		{Name: "LowSnr", Expr: "downstream.snr < 38 for 10m", Severity: "warning"},
+		{Expr: "upstream.power > 51"},
+		{Name: "BondingLost", Expr: "downstream.locked_channels < 4"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+	data := newTestModemStatusData()
+
+	engine.Evaluate(data, now)
+	alerts := engine.Alerts()
+	if len(alerts) != 2 {
+		t.Fatalf("expected the upstream power and bonding alerts to fire right away, got %+v", alerts)
+	}
+	for _, alert := range alerts {
+		switch alert.Labels["alertname"] {
+		case "upstream.power > 51":
+			if alert.Labels["channel_id"] != "2" || alert.Annotations["value"] != "52.5" || alert.Status.State != "active" {
+				t.Errorf("unexpected upstream power alert %+v", alert)
+			}
+		case "BondingLost":
+			if _, ok := alert.Labels["channel_id"]; ok || alert.Annotations["value"] != "3" {
+				t.Errorf("unexpected bonding alert %+v", alert)
+			}
+		default:
+			t.Errorf("unexpected alert %+v", alert)
+		}
+		if alert.Fingerprint == "" || alert.StartsAt != now || !alert.EndsAt.After(now) {
+			t.Errorf("expected a fingerprint and start time, got %+v", alert)
+		}
+	}
+
+	// the SNR rule is pending until its condition held for 10 minutes
+	engine.Evaluate(data, now.Add(5*time.Minute))
+	if len(engine.Alerts()) != 2 {
+		t.Errorf("expected the SNR rule to be pending, got %+v", engine.Alerts())
+	}
+	engine.Evaluate(data, now.Add(10*time.Minute))
+	var snr *collector.Alert
+	for _, alert := range engine.Alerts() {
+		if alert.Labels["alertname"] == "LowSnr" {
+			snr = alert
+		}
+	}
+	if snr == nil || snr.Labels["severity"] != "warning" || snr.Labels["direction"] != collector.DirectionDownstream {
+		t.Fatalf("expected the SNR rule to fire after 10 minutes, got %+v", engine.Alerts())
+	}
+
+	// a channel recovering resolves its alert, which stays visible for a while
+	data.Upstream[1].Power = "45.0 dBmV"
+	engine.Evaluate(data, now.Add(11*time.Minute))
+	for _, alert := range engine.Alerts() {
+		if alert.Labels["alertname"] == "upstream.power > 51" && (alert.Status.State != "active" || alert.EndsAt != now.Add(11*time.Minute)) {
+			t.Errorf("expected the upstream power alert to be resolved, got %+v", alert)
+		}
+	}
+	engine.Evaluate(data, now.Add(time.Hour))
+	for _, alert := range engine.Alerts() {
+		if alert.Labels["alertname"] == "upstream.power > 51" {
+			t.Errorf("expected the resolved alert to expire, got %+v", alert)
+		}
+	}
+}
+
+func TestRuleEngineInvalidRules(t *testing.T) {
+	for _, expr := range []string{
+		"downstream.snr",
+		"downstream.noise < 3",
+		"upstream.snr < 30",
+		"downstream.snr < 33 for ever",
+	} {
+		if _, err := collector.NewRuleEngine([]*collector.RuleConfig{{Expr: expr}}); err == nil {
+			t.Errorf("expected %q to be rejected", expr)
+		}
+	}
+}
+
+func TestRuleEngineAlertmanagerFormat(t *testing.T) {
+	engine, err := collector.NewRuleEngine([]*collector.RuleConfig{{Expr: "upstream.power > 51"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+	data := newTestModemStatusData()
+	engine.Evaluate(data, now)
+	engine.Evaluate(data, now.Add(2*time.Minute))
+
+	// the fields of gettableAlert in the Alertmanager v2 OpenAPI spec
+	required := []string{"labels", "annotations", "receivers", "fingerprint", "updatedAt", "startsAt", "endsAt", "status"}
+	optional := map[string]bool{"generatorURL": true}
+	check := func(expectedEnd time.Time) {
+		encoded, err := json.Marshal(engine.Alerts())
+		if err != nil {
+			t.Fatal(err)
+		}
+		var alerts []map[string]json.RawMessage
+		if err := json.Unmarshal(encoded, &alerts); err != nil {
+			t.Fatal(err)
+		}
+		if len(alerts) != 1 {
+			t.Fatalf("expected 1 alert, got %s", encoded)
+		}
+		for _, field := range required {
+			if _, ok := alerts[0][field]; !ok {
+				t.Errorf("expected the field %s, got %s", field, encoded)
+			}
+			optional[field] = true
+		}
+		for field := range alerts[0] {
+			if !optional[field] {
+				t.Errorf("unexpected field %s", field)
+			}
+		}
+		var alert struct {
+			EndsAt    time.Time `json:"endsAt"`
+			Receivers []struct {
+				Name string `json:"name"`
+			} `json:"receivers"`
+			Status struct {
+				State       string   `json:"state"`
+				SilencedBy  []string `json:"silencedBy"`
+				InhibitedBy []string `json:"inhibitedBy"`
+			} `json:"status"`
+		}
+		if err := json.Unmarshal(encoded[1:len(encoded)-1], &alert); err != nil {
+			t.Fatal(err)
+		}
+		if alert.Status.State != "active" || alert.Status.SilencedBy == nil || alert.Status.InhibitedBy == nil || alert.Receivers == nil {
+			t.Errorf("expected an active alert, got %s", encoded)
+		}
+		if !alert.EndsAt.Equal(expectedEnd) {
+			t.Errorf("expected the alert to end at %s, got %s", expectedEnd, alert.EndsAt)
+		}
+	}
+
+	// firing alerts end four evaluation intervals after the last evaluation
+	check(now.Add(10 * time.Minute))
+	// resolved alerts end when they were resolved
+	data.Upstream[1].Power = "45.0 dBmV"
+	engine.Evaluate(data, now.Add(4*time.Minute))
+	check(now.Add(4 * time.Minute))
+}
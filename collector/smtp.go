@@ -0,0 +1,331 @@
+package collector
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	htmltemplate "html/template"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// SMTP connection security
+const (
+	SMTPStartTLS = "starttls"
+	SMTPTLS      = "tls"
+	SMTPNone     = "none"
+)
+
+// SMTPConfig configures the email notifier
+type SMTPConfig struct {
+	Host string `yaml:"host"`
+	Port int    `yaml:"port"`
+	// Security is starttls (default), tls for implicit TLS, usually on port 465, or none
+	Security           string   `yaml:"security"`
+	InsecureSkipVerify bool     `yaml:"insecure_skip_verify"`
+	Username           string   `yaml:"username"`
+	Password           string   `yaml:"password"`
+	From               string   `yaml:"from"`
+	To                 []string `yaml:"to"`
+	Subject            string   `yaml:"subject"`
+	// Events selects the kinds of events that trigger a digest
+	Events []string `yaml:"events"`
+	// Debounce is how long events are collected into one digest
+	Debounce     time.Duration `yaml:"debounce"`
+	Retries      int           `yaml:"retries"`
+	RetryBackoff time.Duration `yaml:"retry_backoff"`
+	// QuietHours hold back digests, they are sent once the quiet hours are over
+	QuietHours *QuietHours `yaml:"quiet_hours"`
+}
+
+// QuietHours is a daily period in local time, e.g. from 22:00 to 07:00
+type QuietHours struct {
+	Start string `yaml:"start"`
+	End   string `yaml:"end"`
+
+	start, end int
+}
+
+// DefaultSMTPConfig returns the settings used for everything the configuration doesn't set
+func DefaultSMTPConfig() *SMTPConfig {
+	return &SMTPConfig{
+		Port:         587,
+		Security:     SMTPStartTLS,
+		Subject:      "Fibertel line status changed",
+		Events:       []string{EventHealthChanged, EventGatewayUnreachable, EventGatewayReachable},
+		Debounce:     5 * time.Minute,
+		Retries:      3,
+		RetryBackoff: 30 * time.Second,
+	}
+}
+
+func parseTimeOfDay(str string) (int, error) {
+	parsed, err := time.Parse("15:04", str)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, expected e.g. 22:00", str)
+	}
+	return parsed.Hour()*60 + parsed.Minute(), nil
+}
+
+// contains returns whether t is within the quiet hours, which may span midnight
+func (q *QuietHours) contains(t time.Time) bool {
+	minute := t.Hour()*60 + t.Minute()
+	if q.start <= q.end {
+		return minute >= q.start && minute < q.end
+	}
+	return minute >= q.start || minute < q.end
+}
+
+// until returns the time until the quiet hours end
+func (q *QuietHours) until(t time.Time) time.Duration {
+	end := time.Date(t.Year(), t.Month(), t.Day(), q.end/60, q.end%60, 0, 0, t.Location())
+	if !end.After(t) {
+		end = end.AddDate(0, 0, 1)
+	}
+	return end.Sub(t)
+}
+
+// SMTPNotifier emails a digest of the line state transitions along with the channel table
+type SMTPNotifier struct {
+	config *SMTPConfig
+	events map[string]bool
+	queue  *notifyQueue
+
+	mu   sync.Mutex
+	held *Notification
+}
+
+func NewSMTPNotifier(config *SMTPConfig) (*SMTPNotifier, error) {
+	if config.Host == "" || config.From == "" || len(config.To) == 0 {
+		return nil, fmt.Errorf("smtp needs a host, from and to")
+	}
+	switch config.Security {
+	case SMTPStartTLS, SMTPTLS, SMTPNone:
+	default:
+		return nil, fmt.Errorf("unknown smtp security %q, expected starttls, tls or none", config.Security)
+	}
+	if config.QuietHours != nil {
+		var err error
+		if config.QuietHours.start, err = parseTimeOfDay(config.QuietHours.Start); err != nil {
+			return nil, err
+		}
+		if config.QuietHours.end, err = parseTimeOfDay(config.QuietHours.End); err != nil {
+			return nil, err
+		}
+	}
+	notifier := &SMTPNotifier{config: config, events: make(map[string]bool)}
+	for _, kind := range config.Events {
+		notifier.events[kind] = true
+	}
+	notifier.queue = &notifyQueue{
+		debounce: config.Debounce,
+		retries:  config.Retries,
+		backoff:  config.RetryBackoff,
+		send:     notifier.send,
+	}
+	return notifier, nil
+}
+
+// Notify queues the events that trigger a digest
+func (n *SMTPNotifier) Notify(notification *Notification) {
+	filtered := *notification
+	filtered.Events = nil
+	for _, event := range notification.Events {
+		if n.events[event.Kind] {
+			filtered.Events = append(filtered.Events, event)
+		}
+	}
+	n.queue.add(&filtered)
+}
+
+func (n *SMTPNotifier) send(notification *Notification) error {
+	if quiet := n.config.QuietHours; quiet != nil && quiet.contains(time.Now()) {
+		n.hold(notification, quiet.until(time.Now()))
+		return nil
+	}
+	message, err := n.message(notification)
+	if err != nil {
+		return err
+	}
+	return n.deliver(message)
+}
+
+// hold keeps the digest until the quiet hours are over and then queues it again
+func (n *SMTPNotifier) hold(notification *Notification, until time.Duration) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.held != nil {
+		n.held.Events = append(n.held.Events, notification.Events...)
+		n.held.Status, n.held.Health, n.held.Time = notification.Status, notification.Health, notification.Time
+		return
+	}
+	held := *notification
+	n.held = &held
+	time.AfterFunc(until, func() {
+		n.mu.Lock()
+		held := n.held
+		n.held = nil
+		n.mu.Unlock()
+		n.queue.add(held)
+	})
+}
+
+func (n *SMTPNotifier) deliver(message []byte) error {
+	address := net.JoinHostPort(n.config.Host, strconv.Itoa(n.config.Port))
+	tlsConfig := &tls.Config{ServerName: n.config.Host, InsecureSkipVerify: n.config.InsecureSkipVerify}
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+	var conn net.Conn
+	var err error
+	if n.config.Security == SMTPTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", address, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", address)
+	}
+	if err != nil {
+		return err
+	}
+	client, err := smtp.NewClient(conn, n.config.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if n.config.Security == SMTPStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("%s doesn't support STARTTLS", address)
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+	if n.config.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", n.config.Username, n.config.Password, n.config.Host)); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(n.config.From); err != nil {
+		return err
+	}
+	for _, to := range n.config.To {
+		if err := client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(message); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// smtpData is what the email templates are executed with
+type smtpData struct {
+	Notification *Notification
+	Channels     []*ReportChannel
+}
+
+const smtpTextTemplate = `{{ .Notification.Text }}
+{{ if .Channels }}
+Direction        Channel  Frequency    Power        SNR        Lock        Result
+{{ range .Channels }}{{ printf "%-16s %-8s %-12s %-12s %-10s %-11s %s" .Direction .ChannelId .Frequency .Power .Snr .Locked .Result }}
+{{ end }}{{ else }}
+The gateway couldn't be polled, there is no channel table.
+{{ end }}`
+
+const smtpHTMLTemplate = `<html>
+<body style="font-family: sans-serif">
+<p>Fibertel gateway {{ .Notification.Gateway }}:</p>
+<ul>
+{{ range .Notification.Events }}<li>{{ .Message }}</li>
+{{ end }}</ul>
+{{ if .Channels }}<table style="border-collapse: collapse">
+<tr><th>Direction</th><th>Channel</th><th>Frequency</th><th>Power</th><th>SNR</th><th>Lock</th><th>Result</th></tr>
+{{ range .Channels }}<tr style="background: {{ resultColor .Result }}"><td>{{ .Direction }}</td><td>{{ .ChannelId }}</td><td>{{ .Frequency }}</td><td>{{ .Power }}</td><td>{{ .Snr }}</td><td>{{ .Locked }}</td><td>{{ .Result }}</td></tr>
+{{ end }}</table>
+{{ else }}<p>The gateway couldn't be polled, there is no channel table.</p>
+{{ end }}</body>
+</html>
+`
+
+var (
+	smtpText = template.Must(template.New("text").Parse(smtpTextTemplate))
+	smtpHTML = htmltemplate.Must(htmltemplate.New("html").Funcs(htmltemplate.FuncMap{
+		"resultColor": func(result string) string {
+			switch result {
+			case "pass":
+				return "#d4edda"
+			case "marginal":
+				return "#fff3cd"
+			}
+			return "#f8d7da"
+		},
+	}).Parse(smtpHTMLTemplate))
+)
+
+// message builds a multipart/alternative email with a plain text and an HTML part
+func (n *SMTPNotifier) message(notification *Notification) ([]byte, error) {
+	data := &smtpData{Notification: notification}
+	if notification.Status != nil && notification.Health != nil {
+		data.Channels = reportChannels(notification.Status, notification.Health)
+	}
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for _, part := range []struct {
+		contentType string
+		execute     func(w *quotedprintable.Writer) error
+	}{
+		{"text/plain; charset=utf-8", func(w *quotedprintable.Writer) error { return smtpText.Execute(w, data) }},
+		{"text/html; charset=utf-8", func(w *quotedprintable.Writer) error { return smtpHTML.Execute(w, data) }},
+	} {
+		partWriter, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		encoder := quotedprintable.NewWriter(partWriter)
+		if err := part.execute(encoder); err != nil {
+			return nil, err
+		}
+		if err := encoder.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	var message bytes.Buffer
+	headers := [][2]string{
+		{"From", n.config.From},
+		{"To", strings.Join(n.config.To, ", ")},
+		{"Subject", n.config.Subject},
+		{"Date", notification.Time.Format(time.RFC1123Z)},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", "multipart/alternative; boundary=" + writer.Boundary()},
+	}
+	for _, header := range headers {
+		fmt.Fprintf(&message, "%s: %s\r\n", header[0], header[1])
+	}
+	message.WriteString("\r\n")
+	message.Write(body.Bytes())
+	return message.Bytes(), nil
+}
@@ -0,0 +1,201 @@
+package collector_test
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"github.com/reynico/fibertel-station-exporter/collector"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http/httptest"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+type receivedMail struct {
+	auth    string
+	from    string
+	to      []string
+	message string
+}
+
+// newTestSMTPServer starts a stand-in for an SMTP server that supports STARTTLS and AUTH PLAIN
+func newTestSMTPServer(t *testing.T) (net.Listener, chan *receivedMail) {
+	// borrow the self-signed certificate of an httptest TLS server
+	tlsServer := httptest.NewTLSServer(nil)
+	tlsConfig := &tls.Config{Certificates: tlsServer.TLS.Certificates}
+	tlsServer.Close()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	mails := make(chan *receivedMail, 10)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveSMTP(conn, tlsConfig, mails)
+		}
+	}()
+	return listener, mails
+}
+
+func serveSMTP(conn net.Conn, tlsConfig *tls.Config, mails chan *receivedMail) {
+	text := textproto.NewConn(conn)
+	defer func() { text.Close() }()
+	text.PrintfLine("220 localhost ESMTP")
+	received := &receivedMail{}
+	secure := false
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		command := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch command {
+		case "EHLO":
+			if secure {
+				text.PrintfLine("250-localhost\r\n250 AUTH PLAIN")
+			} else {
+				text.PrintfLine("250-localhost\r\n250 STARTTLS")
+			}
+		case "STARTTLS":
+			text.PrintfLine("220 ready")
+			conn = tls.Server(conn, tlsConfig)
+			text = textproto.NewConn(conn)
+			secure = true
+		case "AUTH":
+			credentials, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(line, "AUTH PLAIN "))
+			received.auth = string(credentials)
+			text.PrintfLine("235 authenticated")
+		case "MAIL":
+			received.from = line
+			text.PrintfLine("250 ok")
+		case "RCPT":
+			received.to = append(received.to, line)
+			text.PrintfLine("250 ok")
+		case "DATA":
+			text.PrintfLine("354 go ahead")
+			message, _ := io.ReadAll(text.DotReader())
+			received.message = string(message)
+			text.PrintfLine("250 queued")
+			mails <- received
+			received = &receivedMail{}
+		case "QUIT":
+			text.PrintfLine("221 bye")
+			return
+		default:
+			text.PrintfLine("250 ok")
+		}
+	}
+}
+
+func TestSMTPNotifier(t *testing.T) {
+	listener, mails := newTestSMTPServer(t)
+	config := collector.DefaultSMTPConfig()
+	config.Host = "127.0.0.1"
+	config.Port = listener.Addr().(*net.TCPAddr).Port
+	config.InsecureSkipVerify = true
+	config.Username = "exporter"
+	config.Password = "s3cret"
+	config.From = "exporter@example.com"
+	config.To = []string{"me@example.com", "you@example.com"}
+	config.Debounce = 10 * time.Millisecond
+	notifier, err := collector.NewSMTPNotifier(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := newTestModemStatusData()
+	// events the notifier isn't interested in don't trigger a digest
+	notifier.Notify(&collector.Notification{Time: time.Now(), Events: []*collector.Event{{Kind: collector.EventDefaultPassword}}, Status: data})
+	notifier.Notify(&collector.Notification{
+		Time:    time.Now(),
+		Gateway: "192.168.100.1",
+		Events:  []*collector.Event{{Kind: collector.EventHealthChanged, Message: "Downstream channel 2 power changed from good to marginal"}},
+		Status:  data,
+		Health:  collector.EvaluateHealth(data, nil),
+	})
+
+	var received *receivedMail
+	select {
+	case received = <-mails:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected an email")
+	}
+	if received.auth != "\x00exporter\x00s3cret" {
+		t.Errorf("unexpected credentials %q", received.auth)
+	}
+	if received.from != "MAIL FROM:<exporter@example.com>" || len(received.to) != 2 {
+		t.Errorf("unexpected envelope %q %q", received.from, received.to)
+	}
+
+	message, err := mail.ReadMessage(strings.NewReader(received.message))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mediaType, params, _ := mime.ParseMediaType(message.Header.Get("Content-Type"))
+	if mediaType != "multipart/alternative" {
+		t.Fatalf("expected a multipart/alternative email, got %s", mediaType)
+	}
+	parts := make(map[string]string)
+	reader := multipart.NewReader(message.Body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			break
+		}
+		content, _ := io.ReadAll(part)
+		contentType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		parts[contentType] = string(content)
+	}
+	if text := parts["text/plain"]; !strings.Contains(text, "power changed from good to marginal") || !strings.Contains(text, "609 MHz") {
+		t.Errorf("expected the event and the channel table in the text part, got %q", text)
+	}
+	if html := parts["text/html"]; !strings.Contains(html, "<td>marginal</td>") {
+		t.Errorf("expected the channel table in the HTML part, got %q", html)
+	}
+}
+
+func TestSMTPNotifierQuietHours(t *testing.T) {
+	listener, mails := newTestSMTPServer(t)
+	now := time.Now()
+	config := collector.DefaultSMTPConfig()
+	config.Host = "127.0.0.1"
+	config.Port = listener.Addr().(*net.TCPAddr).Port
+	config.Security = collector.SMTPNone
+	config.From = "exporter@example.com"
+	config.To = []string{"me@example.com"}
+	config.Debounce = 10 * time.Millisecond
+	config.QuietHours = &collector.QuietHours{
+		Start: now.Add(-time.Hour).Format("15:04"),
+		End:   now.Add(time.Hour).Format("15:04"),
+	}
+	notifier, err := collector.NewSMTPNotifier(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	notifier.Notify(&collector.Notification{Time: now, Events: []*collector.Event{{Kind: collector.EventGatewayUnreachable, Message: "The gateway is unreachable"}}})
+	select {
+	case received := <-mails:
+		t.Errorf("expected no email during quiet hours, got %q", received.message)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestSMTPConfigValidation(t *testing.T) {
+	config := collector.DefaultSMTPConfig()
+	config.Host, config.From, config.To = "localhost", "a@example.com", []string{"b@example.com"}
+	config.QuietHours = &collector.QuietHours{Start: "22:00", End: "7pm"}
+	if _, err := collector.NewSMTPNotifier(config); err == nil {
+		t.Errorf("expected an invalid quiet hours end to be rejected")
+	}
+}
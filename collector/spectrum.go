@@ -0,0 +1,182 @@
+package collector
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"math"
+	"sort"
+	"strings"
+)
+
+var (
+	downstreamPowerSlopeDesc  *prometheus.Desc
+	downstreamSnrSlopeDesc    *prometheus.Desc
+	downstreamPowerSpreadDesc *prometheus.Desc
+	downstreamSnrSpreadDesc   *prometheus.Desc
+	downstreamDipsDesc        *prometheus.Desc
+)
+
+func init() {
+	downstreamPowerSlopeDesc = prometheus.NewDesc(prefix+"downstream_power_slope_dB_per_100MHz", "Slope (tilt) of the downstream power over frequency", nil, nil)
+	downstreamSnrSlopeDesc = prometheus.NewDesc(prefix+"downstream_snr_slope_dB_per_100MHz", "Slope of the downstream SNR over frequency", nil, nil)
+	downstreamPowerSpreadDesc = prometheus.NewDesc(prefix+"downstream_power_spread_dB", "Difference between the strongest and weakest downstream channel", nil, nil)
+	downstreamSnrSpreadDesc = prometheus.NewDesc(prefix+"downstream_snr_spread_dB", "Difference between the best and worst downstream SNR", nil, nil)
+	downstreamDipsDesc = prometheus.NewDesc(prefix+"downstream_dips", "Number of downstream channels that are notably below both neighbouring channels", []string{"check"}, nil)
+}
+
+// DipThreshold is how many dB a channel has to be below the average of its neighbours to count as a dip
+const DipThreshold = 3.0
+
+// SpectrumPoint is a locked downstream channel placed on the frequency axis
+type SpectrumPoint struct {
+	ChannelId    string  `json:"channel_id"`
+	ChannelType  string  `json:"channel_type"`
+	FrequencyMHz float64 `json:"frequency_mhz"`
+	Power        float64 `json:"power_dbmv"`
+	Snr          float64 `json:"snr_db"`
+}
+
+// SpectrumDip is a channel that sits in a notch, e.g. caused by a bad splitter
+type SpectrumDip struct {
+	ChannelId    string  `json:"channel_id"`
+	FrequencyMHz float64 `json:"frequency_mhz"`
+	Check        string  `json:"check"`
+	Depth        float64 `json:"depth_db"`
+}
+
+// SpectrumReport describes power and SNR of the downstream channel plan over frequency
+type SpectrumReport struct {
+	Points              []*SpectrumPoint `json:"points"`
+	PowerSlopePer100MHz float64          `json:"power_slope_db_per_100mhz"`
+	SnrSlopePer100MHz   float64          `json:"snr_slope_db_per_100mhz"`
+	PowerSpread         float64          `json:"power_spread_db"`
+	SnrSpread           float64          `json:"snr_spread_db"`
+	Dips                []*SpectrumDip   `json:"dips"`
+}
+
+// AnalyzeSpectrum computes tilt, spread and dips over the locked SC-QAM and OFDM downstream channels
+func AnalyzeSpectrum(data *ModemStatusData) *SpectrumReport {
+	report := &SpectrumReport{Points: []*SpectrumPoint{}, Dips: []*SpectrumDip{}}
+	for _, channel := range data.Downstream {
+		if channel.Locked != "Locked" {
+			continue
+		}
+		report.Points = append(report.Points, &SpectrumPoint{
+			ChannelId:    channel.ChannelId,
+			ChannelType:  channel.ChannelType,
+			FrequencyMHz: parseFrequencyMHz(channel.CentralFrequency),
+			Power:        parse2float(channel.Power),
+			Snr:          parse2float(channel.Snr),
+		})
+	}
+	for _, channel := range data.OfdmDownstreamData {
+		if channel.LockedOfdm != "Locked" {
+			continue
+		}
+		report.Points = append(report.Points, &SpectrumPoint{
+			ChannelId:    channel.ChannelIdOfdm,
+			ChannelType:  channel.ChannelType,
+			FrequencyMHz: parseFrequencyMHz(channel.CentralFrequencyOfdm),
+			Power:        parse2float(channel.PowerOfdm),
+			Snr:          parse2float(channel.SnrOfdm),
+		})
+	}
+	sort.Slice(report.Points, func(i, j int) bool {
+		return report.Points[i].FrequencyMHz < report.Points[j].FrequencyMHz
+	})
+
+	power := func(p *SpectrumPoint) float64 { return p.Power }
+	snr := func(p *SpectrumPoint) float64 { return p.Snr }
+	report.PowerSlopePer100MHz = slopePer100MHz(report.Points, power)
+	report.SnrSlopePer100MHz = slopePer100MHz(report.Points, snr)
+	report.PowerSpread = spread(report.Points, power)
+	report.SnrSpread = spread(report.Points, snr)
+	report.Dips = append(findDips(report.Points, CheckPower, power), findDips(report.Points, CheckSnr, snr)...)
+	return report
+}
+
+// slopePer100MHz fits a least squares line through the values over frequency
+func slopePer100MHz(points []*SpectrumPoint, value func(*SpectrumPoint) float64) float64 {
+	if len(points) < 2 {
+		return 0
+	}
+	var sumX, sumY, sumXY, sumXX float64
+	for _, point := range points {
+		x := point.FrequencyMHz / 100
+		y := value(point)
+		sumX += x
+		sumY += y
+		sumXY += x * y
+		sumXX += x * x
+	}
+	n := float64(len(points))
+	denominator := n*sumXX - sumX*sumX
+	if denominator == 0 {
+		return 0
+	}
+	return (n*sumXY - sumX*sumY) / denominator
+}
+
+func spread(points []*SpectrumPoint, value func(*SpectrumPoint) float64) float64 {
+	if len(points) == 0 {
+		return 0
+	}
+	min, max := math.Inf(1), math.Inf(-1)
+	for _, point := range points {
+		min = math.Min(min, value(point))
+		max = math.Max(max, value(point))
+	}
+	return max - min
+}
+
+func findDips(points []*SpectrumPoint, check string, value func(*SpectrumPoint) float64) []*SpectrumDip {
+	var dips []*SpectrumDip
+	for i := 1; i < len(points)-1; i++ {
+		previous, current, next := value(points[i-1]), value(points[i]), value(points[i+1])
+		depth := (previous+next)/2 - current
+		if current < previous && current < next && depth >= DipThreshold {
+			dips = append(dips, &SpectrumDip{
+				ChannelId:    points[i].ChannelId,
+				FrequencyMHz: points[i].FrequencyMHz,
+				Check:        check,
+				Depth:        depth,
+			})
+		}
+	}
+	return dips
+}
+
+// parseFrequencyMHz normalizes the frequencies reported by the gateway ("602 MHz", "602000000",
+// "0.602 GHz") to MHz. Without a unit, the magnitude tells Hz, MHz and GHz apart since cable
+// channels are all between 5 MHz and 1.8 GHz.
+func parseFrequencyMHz(str string) float64 {
+	value := parse2float(str)
+	lower := strings.ToLower(str)
+	switch {
+	case strings.Contains(lower, "ghz"):
+		return value * 1000
+	case strings.Contains(lower, "mhz"):
+		return value
+	case strings.Contains(lower, "khz"):
+		return value / 1000
+	case value >= 1e5:
+		return value / 1e6
+	case value < 2:
+		return value * 1000
+	}
+	return value
+}
+
+func (c *Collector) collectSpectrum(ch chan<- prometheus.Metric, data *ModemStatusData) {
+	report := AnalyzeSpectrum(data)
+	ch <- prometheus.MustNewConstMetric(downstreamPowerSlopeDesc, prometheus.GaugeValue, report.PowerSlopePer100MHz)
+	ch <- prometheus.MustNewConstMetric(downstreamSnrSlopeDesc, prometheus.GaugeValue, report.SnrSlopePer100MHz)
+	ch <- prometheus.MustNewConstMetric(downstreamPowerSpreadDesc, prometheus.GaugeValue, report.PowerSpread)
+	ch <- prometheus.MustNewConstMetric(downstreamSnrSpreadDesc, prometheus.GaugeValue, report.SnrSpread)
+	dips := map[string]float64{CheckPower: 0, CheckSnr: 0}
+	for _, dip := range report.Dips {
+		dips[dip.Check]++
+	}
+	for check, count := range dips {
+		ch <- prometheus.MustNewConstMetric(downstreamDipsDesc, prometheus.GaugeValue, count, check)
+	}
+}
@@ -0,0 +1,47 @@
+package collector_test
+
+import (
+	"fmt"
+	"github.com/reynico/fibertel-station-exporter/collector"
+	"math"
+	"testing"
+)
+
+func TestAnalyzeSpectrum(t *testing.T) {
+	data := &collector.ModemStatusData{}
+	// 10 channels from 600 to 654 MHz with a tilt of -10 dB/100MHz and a notch at 630 MHz
+	for i := 0; i < 10; i++ {
+		power := -float64(i) * 0.6
+		snr := 38.0
+		if i == 5 {
+			power -= 5
+			snr = 33
+		}
+		data.Downstream = append(data.Downstream, &collector.DocsisDownstreamChannel{
+			ChannelId:        fmt.Sprint(i + 1),
+			CentralFrequency: fmt.Sprintf("%d000000", 600+i*6),
+			Power:            fmt.Sprintf("%.2f dBmV", power),
+			Snr:              fmt.Sprintf("%.1f dB", snr),
+			Modulation:       "256QAM",
+			Locked:           "Locked",
+		})
+	}
+	report := collector.AnalyzeSpectrum(data)
+	if len(report.Points) != 10 || report.Points[0].FrequencyMHz != 600 {
+		t.Fatalf("expected 10 points starting at 600 MHz, got %+v", report.Points)
+	}
+	if report.PowerSlopePer100MHz > -9 || report.PowerSlopePer100MHz < -12 {
+		t.Errorf("expected a slope of about -10 dB/100MHz, got %v", report.PowerSlopePer100MHz)
+	}
+	if math.Abs(report.SnrSpread-5) > 1e-9 {
+		t.Errorf("expected an SNR spread of 5 dB, got %v", report.SnrSpread)
+	}
+	if len(report.Dips) != 2 {
+		t.Fatalf("expected a power and an SNR dip, got %+v", report.Dips)
+	}
+	for _, dip := range report.Dips {
+		if dip.ChannelId != "6" || dip.FrequencyMHz != 630 {
+			t.Errorf("expected the dip at channel 6 (630 MHz), got %+v", dip)
+		}
+	}
+}
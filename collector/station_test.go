@@ -0,0 +1,44 @@
+package collector_test
+
+import (
+	"encoding/json"
+	"github.com/reynico/fibertel-station-exporter/collector"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newTestStation starts a stand-in for the gateway web interface that accepts any login and
+// serves the given modem status
+func newTestStation(t *testing.T, data *collector.ModemStatusData) *httptest.Server {
+	return newTestVoiceStation(t, data, nil)
+}
+
+// newTestVoiceStation is newTestStation with a voice status, nil serves an empty one
+func newTestVoiceStation(t *testing.T, data *collector.ModemStatusData, voice *collector.VoiceStatusData) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/api/v1/voice/") && voice != nil:
+			json.NewEncoder(w).Encode(&collector.VoiceStatusResponse{Error: "ok", Data: voice})
+		case r.URL.Path == "/api/v1/session/login" && r.FormValue("password") == "seeksalthash":
+			w.Write([]byte(`{"error":"ok","salt":"s4lt","saltwebui":"s4ltWebUi"}`))
+		case r.URL.Path == "/api/v1/session/login":
+			w.Write([]byte(`{"error":"ok","message":"all good","data":{"user":"custadmin","uid":"1","Dpd":"No"}}`))
+		case r.URL.Path == "/api/v1/session/logout":
+			w.Write([]byte(`{"error":"ok","message":"bye"}`))
+		case strings.HasPrefix(r.URL.Path, "/api/v1/modem/exUSTbl"):
+			json.NewEncoder(w).Encode(&collector.ModemStatusResponse{Error: "ok", Data: data})
+		case strings.HasPrefix(r.URL.Path, "/api/v1/system/"):
+			w.Write([]byte(`{"error":"ok","data":{"ModelName":"CGA4233TCH3","SoftwareVersion":"CGA4233TCH3-1.0.5","SerialNumber":"CP1234SA5678","CMMACAddress":"a4:91:b1:00:11:22","UpTime":"3 days 04:05:06"}}`))
+		case strings.HasPrefix(r.URL.Path, "/api/v1/modem/EventLogTbl"):
+			w.Write([]byte(`{"error":"ok","data":{"EventLogTbl":[` +
+				`{"__id":"1","Time":"01/01/1970 00:00:12","Priority":"critical","Text":"No Ranging Response received - T3 time-out;CM-MAC=a4:91:b1:00:11:22;CMTS-MAC=00:17:10:aa:bb:cc;CM-QOS=1.1;CM-VER=3.1;"},` +
+				`{"__id":"2","Time":"01/01/1970 00:00:20","Priority":"notice","Text":"CM-STATUS message sent. Event Type Code: 16;CM-MAC=a4:91:b1:00:11:22;"}]}}`))
+		case strings.HasPrefix(r.URL.Path, "/api/v1/"):
+			w.Write([]byte(`{"error":"ok","data":{}}`))
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
@@ -0,0 +1,183 @@
+package collector
+
+import (
+	"encoding/csv"
+	"fmt"
+	"github.com/prometheus/common/log"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	ansiGreen  = "\x1b[32m"
+	ansiYellow = "\x1b[33m"
+	ansiRed    = "\x1b[31m"
+	ansiReset  = "\x1b[0m"
+)
+
+// Status is a snapshot of the line as printed by the status subcommand
+type Status struct {
+	Time     time.Time        `json:"time" yaml:"time"`
+	Gateway  string           `json:"gateway" yaml:"gateway"`
+	Model    string           `json:"model" yaml:"model"`
+	Firmware string           `json:"firmware" yaml:"firmware"`
+	Health   Grade            `json:"health" yaml:"health"`
+	Score    float64          `json:"score" yaml:"score"`
+	Channels []*StatusChannel `json:"channels" yaml:"channels"`
+}
+
+// StatusChannel is a channel with its values parsed, graded with the worst grade of its checks
+type StatusChannel struct {
+	Direction    string  `json:"direction" yaml:"direction"`
+	ChannelId    string  `json:"channel_id" yaml:"channel_id"`
+	FrequencyMHz float64 `json:"frequency_mhz" yaml:"frequency_mhz"`
+	Modulation   string  `json:"modulation" yaml:"modulation"`
+	Power        float64 `json:"power_dbmv" yaml:"power_dbmv"`
+	// Snr is nil for upstream channels, the gateway only measures it downstream
+	Snr    *float64 `json:"snr_db,omitempty" yaml:"snr_db,omitempty"`
+	Locked bool     `json:"locked" yaml:"locked"`
+	Grade  Grade    `json:"grade" yaml:"grade"`
+}
+
+// FetchStatus logs into the gateway once and grades all channels against the profile
+func FetchStatus(station *FibertelStation, profile *ThresholdProfile) (*Status, error) {
+	if _, err := station.Login(); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if _, err := station.Logout(); err != nil {
+			log.Errorf("error logging out: %s", err.Error())
+		}
+	}()
+
+	status := &Status{Time: time.Now(), Gateway: station.URL}
+	// older firmwares don't serve the system information, the channels are what matters
+	if systemInfoResponse, err := station.GetSystemInfo(); err != nil {
+		log.Errorf("error getting system information: %s", err.Error())
+	} else if systemInfoResponse.Data != nil {
+		status.Model = systemInfoResponse.Data.ModelName
+		status.Firmware = systemInfoResponse.Data.SoftwareVersion
+	}
+
+	modemStatusResponse, err := station.GetModemStatus()
+	if err != nil {
+		return nil, err
+	}
+	data := modemStatusResponse.Data
+	if data == nil {
+		return nil, fmt.Errorf("gateway returned no modem status")
+	}
+	health := EvaluateHealth(data, profile)
+	status.Health = health.Overall()
+	status.Score = health.Score
+	for _, channel := range reportChannels(data, health) {
+		statusChannel := &StatusChannel{
+			Direction:    channel.Direction,
+			ChannelId:    channel.ChannelId,
+			FrequencyMHz: parseFrequencyMHz(channel.Frequency),
+			Modulation:   channel.Modulation,
+			Power:        parse2float(channel.Power),
+			Locked:       channel.Locked == "Locked",
+			Grade:        channel.Grade,
+		}
+		if channel.Snr != "" {
+			snr := parse2float(channel.Snr)
+			statusChannel.Snr = &snr
+		}
+		status.Channels = append(status.Channels, statusChannel)
+	}
+	// without any channel there's no line, not a healthy one
+	if len(status.Channels) == 0 {
+		status.Health = Bad
+		status.Score = 0
+	}
+	return status, nil
+}
+
+// WriteTable writes a table per direction for terminals, colouring the grades if color is set
+func (s *Status) WriteTable(w io.Writer, color bool) error {
+	paint := func(grade Grade) string {
+		if !color {
+			return grade.String()
+		}
+		switch grade {
+		case Good:
+			return ansiGreen + grade.String() + ansiReset
+		case Marginal:
+			return ansiYellow + grade.String() + ansiReset
+		}
+		return ansiRed + grade.String() + ansiReset
+	}
+
+	fmt.Fprintf(w, "Gateway:  %s\n", s.Gateway)
+	if s.Model != "" {
+		fmt.Fprintf(w, "Model:    %s\n", s.Model)
+	}
+	if s.Firmware != "" {
+		fmt.Fprintf(w, "Firmware: %s\n", s.Firmware)
+	}
+	fmt.Fprintf(w, "Health:   %s (score %.0f)\n", paint(s.Health), s.Score)
+
+	titles := []struct{ direction, title string }{
+		{DirectionDownstream, "Downstream"},
+		{DirectionOfdmDownstream, "OFDM downstream"},
+		{DirectionUpstream, "Upstream"},
+		{DirectionOfdmUpstream, "OFDMA upstream"},
+	}
+	for _, section := range titles {
+		var channels []*StatusChannel
+		for _, channel := range s.Channels {
+			if channel.Direction == section.direction {
+				channels = append(channels, channel)
+			}
+		}
+		if len(channels) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "\n%s\n", section.title)
+		// the grade is the last column, so its colour codes don't throw off the alignment
+		table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(table, "CHANNEL\tFREQUENCY\tMODULATION\tPOWER\tSNR\tLOCK\tHEALTH")
+		for _, channel := range channels {
+			snr := "-"
+			if channel.Snr != nil {
+				snr = fmt.Sprintf("%.1f dB", *channel.Snr)
+			}
+			lock := "unlocked"
+			if channel.Locked {
+				lock = "locked"
+			}
+			fmt.Fprintf(table, "%s\t%g MHz\t%s\t%.1f dBmV\t%s\t%s\t%s\n", channel.ChannelId, channel.FrequencyMHz, channel.Modulation, channel.Power, snr, lock, paint(channel.Grade))
+		}
+		if err := table.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteCSV writes a row per channel, with an empty SNR for upstream channels
+func (s *Status) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"direction", "channel_id", "frequency_mhz", "modulation", "power_dbmv", "snr_db", "locked", "grade"})
+	for _, channel := range s.Channels {
+		snr := ""
+		if channel.Snr != nil {
+			snr = strconv.FormatFloat(*channel.Snr, 'f', -1, 64)
+		}
+		writer.Write([]string{
+			channel.Direction,
+			channel.ChannelId,
+			strconv.FormatFloat(channel.FrequencyMHz, 'f', -1, 64),
+			channel.Modulation,
+			strconv.FormatFloat(channel.Power, 'f', -1, 64),
+			snr,
+			strconv.FormatBool(channel.Locked),
+			channel.Grade.String(),
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,86 @@
+package collector_test
+
+import (
+	"bytes"
+	"encoding/csv"
+	"github.com/reynico/fibertel-station-exporter/collector"
+	"gopkg.in/yaml.v2"
+	"strings"
+	"testing"
+)
+
+func TestFetchStatus(t *testing.T) {
+	station := newTestStation(t, newTestModemStatusData())
+	status, err := collector.FetchStatus(collector.NewFibertelStation(station.URL, "custadmin", "password"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Model != "CGA4233TCH3" || status.Firmware != "CGA4233TCH3-1.0.5" {
+		t.Errorf("expected the model and firmware, got %q %q", status.Model, status.Firmware)
+	}
+	if status.Health != collector.Bad {
+		t.Errorf("expected the unlocked channel to make the line bad, got %s", status.Health)
+	}
+	var snr *collector.StatusChannel
+	for _, channel := range status.Channels {
+		if channel.Direction == collector.DirectionDownstream && channel.ChannelId == "2" {
+			snr = channel
+		}
+		if channel.Direction == collector.DirectionUpstream && channel.Snr != nil {
+			t.Errorf("expected no SNR for upstream channel %s", channel.ChannelId)
+		}
+	}
+	if snr == nil || snr.Snr == nil || *snr.Snr != 31.2 || snr.Grade != collector.Marginal {
+		t.Errorf("expected downstream channel 2 to be marginal, got %+v", snr)
+	}
+
+	var plain, colored bytes.Buffer
+	if err := status.WriteTable(&plain, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := status.WriteTable(&colored, true); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(plain.String(), "Downstream") || !strings.Contains(plain.String(), "31.2 dB") || strings.Contains(plain.String(), "\x1b[") {
+		t.Errorf("expected an uncoloured downstream table, got %s", plain.String())
+	}
+	if !strings.Contains(colored.String(), "\x1b[33mmarginal\x1b[0m") {
+		t.Errorf("expected the marginal grade in yellow, got %q", colored.String())
+	}
+
+	var rows bytes.Buffer
+	if err := status.WriteCSV(&rows); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(&rows).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != len(status.Channels)+1 || records[0][5] != "snr_db" {
+		t.Errorf("expected a header and a row per channel, got %v", records)
+	}
+
+	encoded, err := yaml.Marshal(status)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(encoded), "health: bad") {
+		t.Errorf("expected the grades as text, got %s", encoded)
+	}
+}
+
+func TestFetchStatusWithoutChannels(t *testing.T) {
+	station := newTestStation(t, &collector.ModemStatusData{})
+	status, err := collector.FetchStatus(collector.NewFibertelStation(station.URL, "custadmin", "password"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Health != collector.Bad || status.Score != 0 {
+		t.Errorf("expected a line without channels to be bad, got %s with score %g", status.Health, status.Score)
+	}
+
+	station = newTestStation(t, nil)
+	if _, err := collector.FetchStatus(collector.NewFibertelStation(station.URL, "custadmin", "password"), nil); err == nil {
+		t.Errorf("expected an error without modem status")
+	}
+}
@@ -0,0 +1,159 @@
+package collector
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"math"
+	"strings"
+)
+
+var (
+	summaryPowerMinDesc      *prometheus.Desc
+	summaryPowerAvgDesc      *prometheus.Desc
+	summaryPowerMaxDesc      *prometheus.Desc
+	summarySnrMinDesc        *prometheus.Desc
+	summarySnrAvgDesc        *prometheus.Desc
+	summarySnrMaxDesc        *prometheus.Desc
+	summaryChannelsDesc      *prometheus.Desc
+	summaryLockedDesc        *prometheus.Desc
+	summaryOfdmChannelsDesc  *prometheus.Desc
+	summaryScQamChannelsDesc *prometheus.Desc
+	summarySpectrumDesc      *prometheus.Desc
+)
+
+func init() {
+	directionLabels := []string{"direction"}
+	summaryPowerMinDesc = prometheus.NewDesc(prefix+"summary_power_min_dBmV", "Lowest power of all locked channels", directionLabels, nil)
+	summaryPowerAvgDesc = prometheus.NewDesc(prefix+"summary_power_avg_dBmV", "Average power of all locked channels", directionLabels, nil)
+	summaryPowerMaxDesc = prometheus.NewDesc(prefix+"summary_power_max_dBmV", "Highest power of all locked channels", directionLabels, nil)
+	summarySnrMinDesc = prometheus.NewDesc(prefix+"summary_snr_min_dB", "Lowest SNR of all locked channels", directionLabels, nil)
+	summarySnrAvgDesc = prometheus.NewDesc(prefix+"summary_snr_avg_dB", "Average SNR of all locked channels", directionLabels, nil)
+	summarySnrMaxDesc = prometheus.NewDesc(prefix+"summary_snr_max_dB", "Highest SNR of all locked channels", directionLabels, nil)
+	summaryChannelsDesc = prometheus.NewDesc(prefix+"summary_channels", "Number of channels", directionLabels, nil)
+	summaryLockedDesc = prometheus.NewDesc(prefix+"summary_locked_channels", "Number of locked channels", directionLabels, nil)
+	summaryOfdmChannelsDesc = prometheus.NewDesc(prefix+"summary_ofdm_channels", "Number of OFDM/OFDMA channels", directionLabels, nil)
+	summaryScQamChannelsDesc = prometheus.NewDesc(prefix+"summary_scqam_channels", "Number of SC-QAM channels", directionLabels, nil)
+	summarySpectrumDesc = prometheus.NewDesc(prefix+"summary_bonded_spectrum_hertz", "Total bandwidth of all locked channels", directionLabels, nil)
+}
+
+// ScQamDownstreamWidth is the width of a downstream SC-QAM channel (ITU-T J.83 Annex B)
+const ScQamDownstreamWidth = 6e6
+
+// DirectionSummary aggregates all channels of one direction, SC-QAM and OFDM alike.
+// Power and SNR statistics only cover locked channels and are zero without any.
+type DirectionSummary struct {
+	PowerMin       float64 `json:"power_min_dbmv"`
+	PowerAvg       float64 `json:"power_avg_dbmv"`
+	PowerMax       float64 `json:"power_max_dbmv"`
+	SnrMin         float64 `json:"snr_min_db"`
+	SnrAvg         float64 `json:"snr_avg_db"`
+	SnrMax         float64 `json:"snr_max_db"`
+	Channels       int     `json:"channels"`
+	LockedChannels int     `json:"locked_channels"`
+	OfdmChannels   int     `json:"ofdm_channels"`
+	ScQamChannels  int     `json:"scqam_channels"`
+	SpectrumHz     float64 `json:"bonded_spectrum_hz"`
+
+	powers []float64
+	snrs   []float64
+}
+
+// LineSummary aggregates downstream and upstream channels
+type LineSummary struct {
+	Downstream *DirectionSummary `json:"downstream"`
+	Upstream   *DirectionSummary `json:"upstream"`
+}
+
+// add counts a channel, snr is NaN for upstream channels which don't report one
+func (s *DirectionSummary) add(ofdm, locked bool, power, snr, width float64) {
+	s.Channels++
+	if ofdm {
+		s.OfdmChannels++
+	} else {
+		s.ScQamChannels++
+	}
+	if !locked {
+		return
+	}
+	s.LockedChannels++
+	s.SpectrumHz += width
+	s.powers = append(s.powers, power)
+	if !math.IsNaN(snr) {
+		s.snrs = append(s.snrs, snr)
+	}
+}
+
+func (s *DirectionSummary) finish() {
+	s.PowerMin, s.PowerAvg, s.PowerMax = minAvgMax(s.powers)
+	s.SnrMin, s.SnrAvg, s.SnrMax = minAvgMax(s.snrs)
+}
+
+// Summarize aggregates the channels of the modem status per direction
+func Summarize(data *ModemStatusData) *LineSummary {
+	summary := &LineSummary{Downstream: &DirectionSummary{}, Upstream: &DirectionSummary{}}
+	for _, channel := range data.Downstream {
+		summary.Downstream.add(false, channel.Locked == "Locked", parse2float(channel.Power), parse2float(channel.Snr), ScQamDownstreamWidth)
+	}
+	for _, channel := range data.OfdmDownstreamData {
+		summary.Downstream.add(true, channel.LockedOfdm == "Locked", parse2float(channel.PowerOfdm), parse2float(channel.SnrOfdm), parseFrequencyMHz(channel.Bandwidth)*1e6)
+	}
+	for _, channel := range data.Upstream {
+		summary.Upstream.add(false, channel.Locked == "Locked", parse2float(channel.Power), math.NaN(), upstreamChannelWidth(channel.SymbolRate))
+	}
+	for _, channel := range data.OfdmUpstreamData {
+		summary.Upstream.add(true, channel.LockedOfdm == "Locked", parse2float(channel.PowerOfdm), math.NaN(), parseFrequencyMHz(channel.Bandwidth)*1e6)
+	}
+	summary.Downstream.finish()
+	summary.Upstream.finish()
+	return summary
+}
+
+// parseSymbolRate returns the symbol rate in symbols per second. The gateway reports it in
+// ksym/s ("5120"), some firmwares in Msym/s ("5.12 Msym/s").
+func parseSymbolRate(str string) float64 {
+	value := parse2float(str)
+	if strings.Contains(strings.ToLower(str), "msym") || value < 100 {
+		return value * 1e6
+	}
+	return value * 1e3
+}
+
+// upstreamChannelWidth derives the occupied bandwidth of an upstream SC-QAM channel from its
+// symbol rate, using the DOCSIS roll-off factor of 0.25
+func upstreamChannelWidth(symbolRate string) float64 {
+	return parseSymbolRate(symbolRate) * 1.25
+}
+
+func minAvgMax(values []float64) (float64, float64, float64) {
+	if len(values) == 0 {
+		return 0, 0, 0
+	}
+	min, max, sum := math.Inf(1), math.Inf(-1), 0.0
+	for _, value := range values {
+		min = math.Min(min, value)
+		max = math.Max(max, value)
+		sum += value
+	}
+	return min, sum / float64(len(values)), max
+}
+
+func (c *Collector) collectSummary(ch chan<- prometheus.Metric, data *ModemStatusData) {
+	summary := Summarize(data)
+	for direction, s := range map[string]*DirectionSummary{DirectionDownstream: summary.Downstream, DirectionUpstream: summary.Upstream} {
+		// without locked channels there's nothing to aggregate, a zero would read as a measurement
+		if len(s.powers) > 0 {
+			ch <- prometheus.MustNewConstMetric(summaryPowerMinDesc, prometheus.GaugeValue, s.PowerMin, direction)
+			ch <- prometheus.MustNewConstMetric(summaryPowerAvgDesc, prometheus.GaugeValue, s.PowerAvg, direction)
+			ch <- prometheus.MustNewConstMetric(summaryPowerMaxDesc, prometheus.GaugeValue, s.PowerMax, direction)
+		}
+		if len(s.snrs) > 0 {
+			ch <- prometheus.MustNewConstMetric(summarySnrMinDesc, prometheus.GaugeValue, s.SnrMin, direction)
+			ch <- prometheus.MustNewConstMetric(summarySnrAvgDesc, prometheus.GaugeValue, s.SnrAvg, direction)
+			ch <- prometheus.MustNewConstMetric(summarySnrMaxDesc, prometheus.GaugeValue, s.SnrMax, direction)
+		}
+		ch <- prometheus.MustNewConstMetric(summaryChannelsDesc, prometheus.GaugeValue, float64(s.Channels), direction)
+		ch <- prometheus.MustNewConstMetric(summaryLockedDesc, prometheus.GaugeValue, float64(s.LockedChannels), direction)
+		ch <- prometheus.MustNewConstMetric(summaryOfdmChannelsDesc, prometheus.GaugeValue, float64(s.OfdmChannels), direction)
+		ch <- prometheus.MustNewConstMetric(summaryScQamChannelsDesc, prometheus.GaugeValue, float64(s.ScQamChannels), direction)
+		ch <- prometheus.MustNewConstMetric(summarySpectrumDesc, prometheus.GaugeValue, s.SpectrumHz, direction)
+	}
+}
@@ -0,0 +1,74 @@
+package collector_test
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/reynico/fibertel-station-exporter/collector"
+	"testing"
+)
+
+func TestSummarize(t *testing.T) {
+	summary := collector.Summarize(newTestModemStatusData())
+
+	downstream := summary.Downstream
+	if downstream.Channels != 5 || downstream.LockedChannels != 4 || downstream.OfdmChannels != 1 || downstream.ScQamChannels != 4 {
+		t.Errorf("unexpected downstream channel counts %+v", downstream)
+	}
+	if downstream.PowerMin != -8.1 || downstream.PowerMax != 2.5 {
+		t.Errorf("expected downstream power from -8.1 to 2.5 dBmV, got %v to %v", downstream.PowerMin, downstream.PowerMax)
+	}
+	if downstream.SnrMin != 29 || downstream.SnrMax != 40 {
+		t.Errorf("expected downstream SNR from 29 to 40 dB, got %v to %v", downstream.SnrMin, downstream.SnrMax)
+	}
+	// three locked 6 MHz SC-QAM channels and a 94 MHz OFDM channel
+	if downstream.SpectrumHz != 112e6 {
+		t.Errorf("expected 112 MHz of downstream spectrum, got %v", downstream.SpectrumHz)
+	}
+
+	upstream := summary.Upstream
+	if upstream.LockedChannels != 2 || upstream.PowerAvg != 48.25 {
+		t.Errorf("unexpected upstream summary %+v", upstream)
+	}
+	// two 5120 ksym/s channels occupy 6.4 MHz each
+	if upstream.SpectrumHz != 12.8e6 {
+		t.Errorf("expected 12.8 MHz of upstream spectrum, got %v", upstream.SpectrumHz)
+	}
+}
+
+func TestCollectSummaryWithoutLockedChannels(t *testing.T) {
+	data := newTestModemStatusData()
+	for _, channel := range data.Downstream {
+		channel.Locked = "Not Locked"
+	}
+	for _, channel := range data.OfdmDownstreamData {
+		channel.LockedOfdm = "Not Locked"
+	}
+	station := newTestStation(t, data)
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(&collector.Collector{
+		Station: collector.NewFibertelStation(station.URL, "custadmin", "password"),
+	})
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	directions := func(name string) []string {
+		var directions []string
+		for _, family := range families {
+			if family.GetName() == name {
+				for _, metric := range family.Metric {
+					directions = append(directions, metric.Label[0].GetValue())
+				}
+			}
+		}
+		return directions
+	}
+	if found := directions("fibertel_summary_power_min_dBmV"); len(found) != 1 || found[0] != collector.DirectionUpstream {
+		t.Errorf("expected the power summary of the upstream only, got %v", found)
+	}
+	if found := directions("fibertel_summary_snr_avg_dB"); len(found) != 0 {
+		t.Errorf("expected no SNR summary without locked downstream channels, got %v", found)
+	}
+	if found := directions("fibertel_summary_locked_channels"); len(found) != 2 {
+		t.Errorf("expected the locked channels of both directions, got %v", found)
+	}
+}
@@ -0,0 +1,70 @@
+package collector
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+	"strings"
+)
+
+var (
+	mtaProvisioningStatusDesc *prometheus.Desc
+	mtaProvisionedDesc        *prometheus.Desc
+	voiceLineRegisteredDesc   *prometheus.Desc
+	voiceLineOffHookDesc      *prometheus.Desc
+)
+
+func init() {
+	mtaProvisioningStatusDesc = prometheus.NewDesc(prefix+"mta_provisioning_status_info", "Provisioning state of the embedded MTA", []string{"status"}, nil)
+	mtaProvisionedDesc = prometheus.NewDesc(prefix+"mta_provisioned_bool", "1 if the embedded MTA was provisioned successfully", nil, nil)
+
+	voiceLineLabels := []string{"line", "number"}
+	voiceLineRegisteredDesc = prometheus.NewDesc(prefix+"voice_line_registered_bool", "1 if the voice line is registered", voiceLineLabels, nil)
+	voiceLineOffHookDesc = prometheus.NewDesc(prefix+"voice_line_off_hook_bool", "1 if the phone on the voice line is off hook", voiceLineLabels, nil)
+}
+
+func describeVoice(ch chan<- *prometheus.Desc) {
+	ch <- mtaProvisioningStatusDesc
+	ch <- mtaProvisionedDesc
+	ch <- voiceLineRegisteredDesc
+	ch <- voiceLineOffHookDesc
+}
+
+func (c *Collector) collectVoice(ch chan<- prometheus.Metric) {
+	voiceStatusResponse, err := c.Station.GetVoiceStatus()
+	switch {
+	case err != nil && !c.voiceLogged:
+		log.Warnf("error getting voice status, the firmware might not support it: %s", err.Error())
+		c.voiceLogged = true
+		return
+	case err != nil:
+		log.Debugf("error getting voice status: %s", err.Error())
+		return
+	}
+	if voiceStatusResponse.Data == nil {
+		return
+	}
+	provisioningState := voiceStatusResponse.Data.ProvisioningState
+	ch <- prometheus.MustNewConstMetric(mtaProvisioningStatusDesc, prometheus.GaugeValue, 1, provisioningState)
+	ch <- prometheus.MustNewConstMetric(mtaProvisionedDesc, prometheus.GaugeValue, bool2float64(isMtaProvisioned(provisioningState)))
+	for _, line := range voiceStatusResponse.Data.Lines {
+		ch <- prometheus.MustNewConstMetric(voiceLineRegisteredDesc, prometheus.GaugeValue, bool2float64(strings.EqualFold(line.RegistrationStatus, "Registered")), line.Line, line.DirectoryNumber)
+		ch <- prometheus.MustNewConstMetric(voiceLineOffHookDesc, prometheus.GaugeValue, bool2float64(isOffHook(line.HookStatus)), line.Line, line.DirectoryNumber)
+	}
+}
+
+// isMtaProvisioned reports whether the provisioning state is one of the success states of
+// pktcMtaDevProvisioningState, passing with warnings or incomplete parsing still leaves the MTA
+// in service; firmwares differ in how they spell them.
+func isMtaProvisioned(state string) bool {
+	switch strings.ToLower(strings.TrimSpace(state)) {
+	case "pass", "passed", "passwithwarnings", "passwithincompleteparsing", "complete", "completed", "provisioned":
+		return true
+	}
+	return false
+}
+
+// isOffHook reports whether the hook status is off hook, spelled "OffHook", "Off-Hook" or "Off Hook"
+func isOffHook(status string) bool {
+	status = strings.NewReplacer("-", "", " ", "", "_", "").Replace(status)
+	return strings.EqualFold(status, "OffHook")
+}
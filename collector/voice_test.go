@@ -0,0 +1,84 @@
+package collector_test
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/reynico/fibertel-station-exporter/collector"
+	"testing"
+)
+
+func gatherVoice(t *testing.T, voice *collector.VoiceStatusData) map[string]*dto.MetricFamily {
+	station := newTestVoiceStation(t, newTestModemStatusData(), voice)
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(&collector.Collector{
+		Station: collector.NewFibertelStation(station.URL, "custadmin", "password"),
+	})
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	byName := make(map[string]*dto.MetricFamily)
+	for _, family := range families {
+		byName[family.GetName()] = family
+	}
+	return byName
+}
+
+func TestCollectMtaProvisioning(t *testing.T) {
+	for state, provisioned := range map[string]float64{
+		"Pass":                      1,
+		" completed ":               1,
+		"Provisioned":               1,
+		"passWithWarnings":          1,
+		"PASSWITHINCOMPLETEPARSING": 1,
+		"fail":                      0,
+		"inProgress":                0,
+	} {
+		families := gatherVoice(t, &collector.VoiceStatusData{ProvisioningState: state})
+		if family := families["fibertel_mta_provisioned_bool"]; family == nil || family.Metric[0].GetGauge().GetValue() != provisioned {
+			t.Errorf("expected provisioned to be %g for %q, got %+v", provisioned, state, family)
+		}
+		if family := families["fibertel_mta_provisioning_status_info"]; family == nil || family.Metric[0].Label[0].GetValue() != state {
+			t.Errorf("expected the provisioning state %q as label, got %+v", state, family)
+		}
+	}
+}
+
+func TestCollectVoiceLines(t *testing.T) {
+	families := gatherVoice(t, &collector.VoiceStatusData{
+		ProvisioningState: "Pass",
+		Lines: []*collector.VoiceLine{
+			{Line: "1", DirectoryNumber: "1145678901", RegistrationStatus: "Registered", HookStatus: "On Hook"},
+			{Line: "2", DirectoryNumber: "1145678902", RegistrationStatus: "registered", HookStatus: "Off Hook"},
+			{Line: "3", DirectoryNumber: "1145678903", RegistrationStatus: "Unregistered", HookStatus: "off-hook"},
+			{Line: "4", DirectoryNumber: "", RegistrationStatus: "Disabled", HookStatus: "OffHook"},
+		},
+	})
+	values := func(name string) map[string]float64 {
+		lines := make(map[string]float64)
+		if family := families[name]; family != nil {
+			for _, metric := range family.Metric {
+				for _, label := range metric.Label {
+					if label.GetName() == "line" {
+						lines[label.GetValue()] = metric.GetGauge().GetValue()
+					}
+				}
+			}
+		}
+		return lines
+	}
+
+	registered := values("fibertel_voice_line_registered_bool")
+	offHook := values("fibertel_voice_line_off_hook_bool")
+	expected := map[string][2]float64{
+		"1": {1, 0},
+		"2": {1, 1},
+		"3": {0, 1},
+		"4": {0, 1},
+	}
+	for line, values := range expected {
+		if registered[line] != values[0] || offHook[line] != values[1] {
+			t.Errorf("expected line %s to be registered %g and off hook %g, got %g and %g", line, values[0], values[1], registered[line], offHook[line])
+		}
+	}
+}
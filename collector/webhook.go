@@ -0,0 +1,149 @@
+package collector
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"text/template"
+	"time"
+)
+
+// Webhook payload formats
+const (
+	WebhookGeneric  = "generic"
+	WebhookSlack    = "slack"
+	WebhookDiscord  = "discord"
+	WebhookTelegram = "telegram"
+)
+
+var webhookTemplates = map[string]string{
+	WebhookGeneric:  `{{ json .Notification }}`,
+	WebhookSlack:    `{"text": {{ json .Text }}}`,
+	WebhookDiscord:  `{"content": {{ json .Text }}}`,
+	WebhookTelegram: `{"chat_id": {{ json .ChatId }}, "text": {{ json .Text }}}`,
+}
+
+var webhookFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		content, err := json.Marshal(v)
+		return string(content), err
+	},
+}
+
+// WebhookConfig configures a webhook notifier
+type WebhookConfig struct {
+	// URL the payload is posted to, for Telegram https://api.telegram.org/bot<token>/sendMessage
+	URL string `yaml:"url"`
+	// Format selects the built-in payload: generic, slack, discord or telegram
+	Format string `yaml:"format"`
+	// Template overrides the payload of the format, see webhookData for the available fields
+	Template string `yaml:"template"`
+	// Headers are added to the request, e.g. for authentication
+	Headers map[string]string `yaml:"headers"`
+	// TelegramChatId is the chat Telegram messages are sent to
+	TelegramChatId string `yaml:"telegram_chat_id"`
+	// Events selects the kinds of events that are sent, all of them if empty
+	Events []string `yaml:"events"`
+	// Debounce is how long events are collected before they are sent as one message
+	Debounce time.Duration `yaml:"debounce"`
+	// Retries is how often a failed request is retried, waiting RetryBackoff doubling on every retry
+	Retries      int           `yaml:"retries"`
+	RetryBackoff time.Duration `yaml:"retry_backoff"`
+}
+
+// DefaultWebhookConfig returns the settings used for everything a webhook doesn't configure
+func DefaultWebhookConfig() *WebhookConfig {
+	return &WebhookConfig{
+		Format:       WebhookGeneric,
+		Debounce:     30 * time.Second,
+		Retries:      3,
+		RetryBackoff: 5 * time.Second,
+	}
+}
+
+// webhookData is what payload templates are executed with, e.g. {{ range .Notification.Events }}
+type webhookData struct {
+	Notification *Notification
+	// Text is the plain text message of the notification
+	Text   string
+	ChatId string
+}
+
+// WebhookNotifier posts the line state transitions to a webhook
+type WebhookNotifier struct {
+	config   *WebhookConfig
+	template *template.Template
+	events   map[string]bool
+	client   *http.Client
+	queue    *notifyQueue
+}
+
+func NewWebhookNotifier(config *WebhookConfig) (*WebhookNotifier, error) {
+	text := config.Template
+	if text == "" {
+		var ok bool
+		if text, ok = webhookTemplates[config.Format]; !ok {
+			return nil, fmt.Errorf("unknown webhook format %q, expected generic, slack, discord or telegram", config.Format)
+		}
+	}
+	tmpl, err := template.New("webhook").Funcs(webhookFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing webhook template: %s", err.Error())
+	}
+	notifier := &WebhookNotifier{
+		config:   config,
+		template: tmpl,
+		events:   make(map[string]bool),
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}
+	for _, kind := range config.Events {
+		notifier.events[kind] = true
+	}
+	notifier.queue = &notifyQueue{
+		debounce: config.Debounce,
+		retries:  config.Retries,
+		backoff:  config.RetryBackoff,
+		send:     notifier.send,
+	}
+	return notifier, nil
+}
+
+// Notify queues the events the webhook is interested in
+func (n *WebhookNotifier) Notify(notification *Notification) {
+	filtered := *notification
+	if len(n.events) > 0 {
+		filtered.Events = nil
+		for _, event := range notification.Events {
+			if n.events[event.Kind] {
+				filtered.Events = append(filtered.Events, event)
+			}
+		}
+	}
+	n.queue.add(&filtered)
+}
+
+func (n *WebhookNotifier) send(notification *Notification) error {
+	var body bytes.Buffer
+	data := &webhookData{Notification: notification, Text: notification.Text(), ChatId: n.config.TelegramChatId}
+	if err := n.template.Execute(&body, data); err != nil {
+		return err
+	}
+	request, err := http.NewRequest("POST", n.config.URL, &body)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	for name, value := range n.config.Headers {
+		request.Header.Set(name, value)
+	}
+	response, err := n.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook returned %s", response.Status)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package collector_test
+
+import (
+	"encoding/json"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/reynico/fibertel-station-exporter/collector"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWebhookNotifier(t *testing.T) {
+	requests := make(chan map[string]string, 10)
+	attempts := 0
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		// the first attempt fails to exercise the retry
+		if attempts == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		payload := make(map[string]string)
+		json.NewDecoder(r.Body).Decode(&payload)
+		requests <- payload
+	}))
+	defer receiver.Close()
+
+	config := collector.DefaultWebhookConfig()
+	config.URL = receiver.URL
+	config.Format = collector.WebhookSlack
+	config.Debounce = 50 * time.Millisecond
+	config.RetryBackoff = 10 * time.Millisecond
+	notifier, err := collector.NewWebhookNotifier(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := newTestModemStatusData()
+	station := newTestStation(t, data)
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(&collector.Collector{
+		Station:   collector.NewFibertelStation(station.URL, "custadmin", "password"),
+		Changes:   collector.NewChannelChangeTracker(),
+		Notifiers: []collector.Notifier{notifier},
+	})
+	gather := func() {
+		if _, err := registry.Gather(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a channel unlocking and relocking within the debounce period isn't worth a message
+	gather()
+	data.Downstream[1].Locked = "Not Locked"
+	gather()
+	data.Downstream[1].Locked = "Locked"
+	gather()
+	select {
+	case payload := <-requests:
+		t.Fatalf("expected the flapping channel to be debounced, got %+v", payload)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	data.Downstream[0].Locked = "Not Locked"
+	gather()
+	select {
+	case payload := <-requests:
+		text := payload["text"]
+		if !strings.Contains(text, "Downstream channel 1 (603 MHz) unlocked") || !strings.Contains(text, "Downstream bonded channels dropped from 4 to 3") {
+			t.Errorf("unexpected message %q", text)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected a webhook request")
+	}
+	if attempts != 2 {
+		t.Errorf("expected the failed request to be retried once, got %d attempts", attempts)
+	}
+}
+
+func TestWebhookTemplate(t *testing.T) {
+	bodies := make(chan string, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body strings.Builder
+		buf := make([]byte, 1024)
+		n, _ := r.Body.Read(buf)
+		body.Write(buf[:n])
+		bodies <- r.Header.Get("Authorization") + " " + body.String()
+	}))
+	defer receiver.Close()
+
+	config := collector.DefaultWebhookConfig()
+	config.URL = receiver.URL
+	config.Debounce = time.Millisecond
+	config.Headers = map[string]string{"Authorization": "Bearer s3cret"}
+	config.Template = `{{ range .Notification.Events }}{{ .Kind }};{{ end }}`
+	config.Events = []string{collector.EventLoginFailed}
+	notifier, err := collector.NewWebhookNotifier(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	notifier.Notify(&collector.Notification{Time: time.Now(), Events: []*collector.Event{
+		{Kind: collector.EventDefaultPassword},
+		{Kind: collector.EventLoginFailed},
+	}})
+	select {
+	case body := <-bodies:
+		if body != "Bearer s3cret login_failed;" {
+			t.Errorf("unexpected request %q", body)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected a webhook request")
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"github.com/reynico/fibertel-station-exporter/collector"
+	"gopkg.in/yaml.v2"
+	"os"
+)
+
+type config struct {
+	// HealthProfiles are threshold profiles selectable with -health.profile, on top of the built-in "default"
+	HealthProfiles map[string]*collector.ThresholdProfile `yaml:"health_profiles"`
+	// Webhooks are notified about line state transitions
+	Webhooks []*collector.WebhookConfig `yaml:"webhooks"`
+	// SMTP emails a digest of line state transitions
+	SMTP *collector.SMTPConfig `yaml:"smtp"`
+	// MQTT publishes the modem status of every poll, with Home Assistant discovery
+	MQTT *collector.MQTTConfig `yaml:"mqtt"`
+	// InfluxDB receives the metrics of every poll
+	InfluxDB *collector.InfluxConfig `yaml:"influxdb"`
+	// OTLP receives the metrics of every poll via OpenTelemetry
+	OTLP *collector.OTLPConfig `yaml:"otlp"`
+	// RemoteWrite receives the samples of every poll via the Prometheus remote write protocol
+	RemoteWrite *collector.RemoteWriteConfig `yaml:"remote_write"`
+	// Pushgateway receives the metrics of every poll, e.g. with -once from a cron job
+	Pushgateway *collector.PushgatewayConfig `yaml:"pushgateway"`
+	// Textfile writes the metrics of every poll for the textfile collector of the node_exporter
+	Textfile *collector.TextfileConfig `yaml:"textfile"`
+	// Rules are threshold alert rules served on /api/alerts
+	Rules []*collector.RuleConfig `yaml:"rules"`
+}
+
+func loadConfig(path string) (*config, error) {
+	cfg := &config{}
+	if path == "" {
+		return cfg, nil
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.UnmarshalStrict(content, cfg); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %s", path, err.Error())
+	}
+
+	// the output sections are decoded again on top of their defaults, so they only have to list
+	// what differs. The first pass already reported any error with its line.
+	var sections struct {
+		Webhooks    []interface{} `yaml:"webhooks"`
+		SMTP        interface{}   `yaml:"smtp"`
+		MQTT        interface{}   `yaml:"mqtt"`
+		InfluxDB    interface{}   `yaml:"influxdb"`
+		OTLP        interface{}   `yaml:"otlp"`
+		RemoteWrite interface{}   `yaml:"remote_write"`
+		Pushgateway interface{}   `yaml:"pushgateway"`
+	}
+	if err := yaml.Unmarshal(content, &sections); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %s", path, err.Error())
+	}
+	for i, webhook := range sections.Webhooks {
+		if cfg.Webhooks[i], err = withDefaults(webhook, collector.DefaultWebhookConfig()); err != nil {
+			return nil, fmt.Errorf("error parsing webhook %d in %s: %s", i+1, path, err.Error())
+		}
+	}
+	if cfg.SMTP, err = withDefaults(sections.SMTP, collector.DefaultSMTPConfig()); err != nil {
+		return nil, fmt.Errorf("error parsing smtp in %s: %s", path, err.Error())
+	}
+	if cfg.MQTT, err = withDefaults(sections.MQTT, collector.DefaultMQTTConfig()); err != nil {
+		return nil, fmt.Errorf("error parsing mqtt in %s: %s", path, err.Error())
+	}
+	if cfg.InfluxDB, err = withDefaults(sections.InfluxDB, collector.DefaultInfluxConfig()); err != nil {
+		return nil, fmt.Errorf("error parsing influxdb in %s: %s", path, err.Error())
+	}
+	if cfg.OTLP, err = withDefaults(sections.OTLP, collector.DefaultOTLPConfig()); err != nil {
+		return nil, fmt.Errorf("error parsing otlp in %s: %s", path, err.Error())
+	}
+	if cfg.RemoteWrite, err = withDefaults(sections.RemoteWrite, collector.DefaultRemoteWriteConfig()); err != nil {
+		return nil, fmt.Errorf("error parsing remote_write in %s: %s", path, err.Error())
+	}
+	if cfg.Pushgateway, err = withDefaults(sections.Pushgateway, collector.DefaultPushgatewayConfig()); err != nil {
+		return nil, fmt.Errorf("error parsing pushgateway in %s: %s", path, err.Error())
+	}
+	return cfg, nil
+}
+
+// withDefaults decodes a config section on top of its defaults, a missing section stays nil
+func withDefaults[T any](section interface{}, defaults *T) (*T, error) {
+	if section == nil {
+		return nil, nil
+	}
+	content, err := yaml.Marshal(section)
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.UnmarshalStrict(content, defaults); err != nil {
+		return nil, err
+	}
+	return defaults, nil
+}
+
+func (c *config) healthProfile(name string) (*collector.ThresholdProfile, error) {
+	if profile, ok := c.HealthProfiles[name]; ok {
+		return profile, nil
+	}
+	if name == "default" {
+		return collector.DefaultThresholdProfile(), nil
+	}
+	return nil, fmt.Errorf("unknown health profile %q", name)
+}
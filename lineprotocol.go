@@ -0,0 +1,32 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/reynico/fibertel-station-exporter/collector"
+	"os"
+	"time"
+)
+
+// runLineProtocol polls the gateway once and prints the metrics as InfluxDB line protocol, for
+// Telegraf's exec input
+func runLineProtocol(cfg *config, args []string) int {
+	flags := flag.NewFlagSet("line-protocol", flag.ContinueOnError)
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	families, err := gatherOnce(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error polling the gateway: %s\n", err.Error())
+		return 1
+	}
+	var tags map[string]string
+	if cfg.InfluxDB != nil {
+		tags = cfg.InfluxDB.Tags
+	}
+	if err := collector.WriteLineProtocol(os.Stdout, families, tags, time.Now()); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing line protocol: %s\n", err.Error())
+		return 1
+	}
+	return 0
+}
@@ -1,15 +1,20 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/prometheus/common/log"
 	"github.com/reynico/fibertel-station-exporter/collector"
 	"net/http"
+	"net/url"
 	"os"
 	"reflect"
+	"strings"
+	"time"
 )
 
 const version = "0.0.1"
@@ -17,12 +22,26 @@ const version = "0.0.1"
 var (
 	showVersion             = flag.Bool("version", false, "Print version and exit")
 	showMetrics             = flag.Bool("show-metrics", false, "Show available metrics and exit")
+	configFile              = flag.String("config.file", "", "Path to an optional YAML configuration file")
 	listenAddress           = flag.String("web.listen-address", "[::]:9420", "Address to listen on")
 	metricsPath             = flag.String("web.telemetry-path", "/metrics", "Path under which to expose metrics")
 	logLevel                = flag.String("log.level", "info", "Logging level")
 	fibertelStationUrl      = flag.String("fibertel.station-url", "https://192.168.100.1", "Fibertel station URL. For bridge mode this is 192.168.100.1 (note: Configure a route if using bridge mode)")
 	fibertelStationUsername = flag.String("fibertel.station-username", "custadmin", "Username for login into the Fibertel gateway")
 	fibertelStationPassword = flag.String("fibertel.station-password", "cga4233", "Password for login into the Fibertel gateway")
+	eventLogSyslogAddress   = flag.String("eventlog.syslog-address", "", "Forward new event log entries to this syslog server, e.g. udp://localhost:514 or tcp://localhost:601")
+	eventLogLokiUrl         = flag.String("eventlog.loki-url", "", "Forward new event log entries to this Loki push API URL, e.g. http://localhost:3100/loki/api/v1/push")
+	channelLabels           = flag.String("collector.channel-labels", "index", "Label per channel series by the gateway's channel ids (index) or by centre frequency in MHz (frequency)")
+	healthProfile           = flag.String("health.profile", "default", "Threshold profile the channel health is evaluated against, see health_profiles in the configuration file")
+	anomalyStateFile        = flag.String("anomaly.state-file", "", "Path of the file the per channel baselines are persisted to, empty keeps them in memory only")
+	anomalyHalfLife         = flag.Duration("anomaly.half-life", collector.DefaultAnomalyHalfLife, "Age at which a sample has lost half of its weight in the per channel baselines")
+	anomalyThreshold        = flag.Float64("anomaly.threshold", collector.DefaultAnomalyThreshold, "Deviation from the baseline in standard deviations from which a channel metric is flagged as anomaly")
+	historyPath             = flag.String("history.path", "", "Path of the file polled modem status snapshots are stored in, empty disables the history")
+	historyRetention        = flag.Duration("history.retention", collector.DefaultHistoryRetention, "How long modem status snapshots are kept in the history")
+	historyMaxSize          = flag.Int64("history.max-size", collector.DefaultHistoryMaxSize, "Size in bytes the history file is kept below by dropping the oldest snapshots, 0 disables the limit")
+	pollInterval            = flag.Duration("poll.interval", 0, "Poll the gateway in this interval in addition to scrapes, e.g. to fill the history without a Prometheus server. 0 disables polling, or polls every minute if an output like influxdb is configured")
+	once                    = flag.Bool("once", false, "Poll the gateway once, push the metrics to the outputs of the configuration file (e.g. pushgateway or textfile) and exit, non-zero on failure")
+	outageLogFile           = flag.String("outage.log-file", "", "Path of the file outages are persisted to, empty keeps them in memory only")
 )
 
 func main() {
@@ -33,6 +52,10 @@ func main() {
 		os.Exit(2)
 	}
 
+	if flag.Arg(0) == "event-code" {
+		os.Exit(lookupEventCode(flag.Args()[1:]))
+	}
+
 	if *showMetrics {
 		describeMetrics()
 		os.Exit(0)
@@ -46,7 +69,32 @@ func main() {
 		os.Exit(0)
 	}
 
-	startServer()
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(2)
+	}
+
+	if *once {
+		// the subcommands poll the gateway once on their own
+		if flag.NArg() > 0 {
+			fmt.Fprintf(os.Stderr, "-once can't be combined with the %s subcommand\n", flag.Arg(0))
+			os.Exit(2)
+		}
+		os.Exit(runOnce(cfg))
+	}
+
+	if flag.Arg(0) == "report" {
+		os.Exit(runReport(cfg, flag.Args()[1:]))
+	}
+	if flag.Arg(0) == "status" {
+		os.Exit(runStatus(cfg, flag.Args()[1:]))
+	}
+	if flag.Arg(0) == "line-protocol" {
+		os.Exit(runLineProtocol(cfg, flag.Args()[1:]))
+	}
+
+	startServer(cfg)
 }
 
 func describeMetrics() {
@@ -84,30 +132,303 @@ func describeMetric(desc *prometheus.Desc) {
 	fmt.Println("")
 }
 
-func startServer() {
+// lookupEventCode prints the event codes matching the given id or event log text, or all
+// known event codes if no argument is given
+func lookupEventCode(args []string) int {
+	if len(args) == 0 {
+		for _, eventCode := range collector.EventCodes() {
+			printEventCode(eventCode)
+		}
+		return 0
+	}
+	query := strings.Join(args, " ")
+	eventCode := collector.LookupEventCode(query)
+	if eventCode == nil {
+		eventCode = collector.ClassifyEventText(query)
+	}
+	if eventCode == nil {
+		fmt.Printf("Unknown event code: %s\n", query)
+		return 1
+	}
+	printEventCode(eventCode)
+	return 0
+}
+
+func printEventCode(eventCode *collector.EventCode) {
+	fmt.Printf("%s: %s\n", eventCode.Id, eventCode.Description)
+	fmt.Printf("  Severity: %s\n", eventCode.Severity)
+	fmt.Printf("  Likely cause: %s\n", eventCode.Cause)
+	fmt.Printf("  Suggested action: %s\n", eventCode.Action)
+}
+
+func startServer(cfg *config) {
 	log.Infof("Starting fibertel-station-exporter (version %s)", version)
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte(`<html>
             <head><title>fibertel-station-exporter (Version ` + version + `)</title></head>
             <body>
             <h1>fibertel-station-exporter</h1>
-            <a href="/metrics">metrics</a>
+            <a href="/metrics">metrics</a><br>
+            <a href="/api/events">event log</a><br>
+            <a href="/api/spectrum">downstream spectrum</a><br>
+            <a href="/api/channel-changes">channel changes</a><br>
+            <a href="/api/outages">outages</a><br>
+            <a href="/api/history">history</a><br>
+            <a href="/api/alerts">alerts</a>
             </body>
             </html>`))
 	})
-	http.HandleFunc(*metricsPath, handleMetricsRequest)
+	// The collector keeps state between scrapes (e.g. to handle gateway counter resets), so a
+	// single instance is shared by all requests.
+	profile, err := cfg.healthProfile(*healthProfile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *channelLabels != "index" && *channelLabels != "frequency" {
+		log.Fatalf("invalid channel labels %q, expected index or frequency", *channelLabels)
+	}
+	eventLog := collector.NewEventLog()
+	gateway := *fibertelStationUrl
+	if parsedUrl, err := url.Parse(*fibertelStationUrl); err == nil {
+		gateway = parsedUrl.Hostname()
+	}
+	if *eventLogSyslogAddress != "" {
+		syslogSink, err := collector.NewSyslogSink(*eventLogSyslogAddress, gateway)
+		if err != nil {
+			log.Fatal(err)
+		}
+		eventLog.AddSink(syslogSink)
+	}
+	if *eventLogLokiUrl != "" {
+		eventLog.AddSink(collector.NewLokiSink(*eventLogLokiUrl, gateway))
+	}
+	outages, err := collector.NewOutageTracker(*outageLogFile)
+	if err != nil {
+		log.Fatalf("error loading outage log: %s", err.Error())
+	}
+	if err := outages.CloseOngoing(); err != nil {
+		log.Fatalf("error saving outage log: %s", err.Error())
+	}
+	anomalies, err := collector.NewAnomalyDetector(*anomalyStateFile)
+	if err != nil {
+		log.Fatalf("error loading anomaly baselines: %s", err.Error())
+	}
+	anomalies.HalfLife = *anomalyHalfLife
+	anomalies.Threshold = *anomalyThreshold
+	var notifiers []collector.Notifier
+	for _, webhook := range cfg.Webhooks {
+		notifier, err := collector.NewWebhookNotifier(webhook)
+		if err != nil {
+			log.Fatal(err)
+		}
+		notifiers = append(notifiers, notifier)
+	}
+	if cfg.SMTP != nil {
+		notifier, err := collector.NewSMTPNotifier(cfg.SMTP)
+		if err != nil {
+			log.Fatal(err)
+		}
+		notifiers = append(notifiers, notifier)
+	}
+	if cfg.MQTT != nil {
+		publisher, err := collector.NewMQTTPublisher(cfg.MQTT)
+		if err != nil {
+			log.Fatal(err)
+		}
+		notifiers = append(notifiers, publisher)
+	}
+	var history *collector.HistoryStore
+	if *historyPath != "" {
+		history, err = collector.NewHistoryStore(*historyPath, *historyRetention, *historyMaxSize)
+		if err != nil {
+			log.Fatalf("error opening history: %s", err.Error())
+		}
+	}
+	rules, err := collector.NewRuleEngine(cfg.Rules)
+	if err != nil {
+		log.Fatal(err)
+	}
+	c := &collector.Collector{
+		Station:         collector.NewFibertelStation(*fibertelStationUrl, *fibertelStationUsername, *fibertelStationPassword),
+		EventLog:        eventLog,
+		Changes:         collector.NewChannelChangeTracker(),
+		Outages:         outages,
+		Notifiers:       notifiers,
+		History:         history,
+		Anomalies:       anomalies,
+		Rules:           rules,
+		FrequencyLabels: *channelLabels == "frequency",
+		HealthProfile:   profile,
+	}
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(c)
+	http.Handle(*metricsPath, promhttp.HandlerFor(registry, promhttp.HandlerOpts{
+		ErrorLog:      log.NewErrorLogger(),
+		ErrorHandling: promhttp.ContinueOnError,
+	}))
+
+	http.HandleFunc("/api/events", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, eventLog.Recent())
+	})
+	http.HandleFunc("/api/channel-changes", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, c.Changes.History())
+	})
+	http.HandleFunc("/api/outages", func(w http.ResponseWriter, r *http.Request) {
+		since, err := timeParam(r, "since", time.Time{})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if r.URL.Query().Get("format") == "csv" {
+			w.Header().Set("Content-Type", "text/csv")
+			if err := outages.WriteCSV(w, since); err != nil {
+				log.Errorf("error writing CSV response: %s", err.Error())
+			}
+			return
+		}
+		writeJSON(w, outages.Outages(since))
+	})
+	http.HandleFunc("/api/spectrum", func(w http.ResponseWriter, r *http.Request) {
+		data, _ := c.LastModemStatus()
+		if data == nil {
+			http.Error(w, "no modem status collected yet", http.StatusServiceUnavailable)
+			return
+		}
+		writeJSON(w, collector.AnalyzeSpectrum(data))
+	})
+
+	http.HandleFunc("/api/history", func(w http.ResponseWriter, r *http.Request) {
+		if history == nil {
+			http.Error(w, "history is disabled, see -history.path", http.StatusNotFound)
+			return
+		}
+		now := time.Now()
+		from, err := timeParam(r, "from", now.Add(-24*time.Hour))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		to, err := timeParam(r, "to", now)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		series, err := history.Query(from, to, r.URL.Query().Get("channel"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if r.URL.Query().Get("format") == "csv" {
+			w.Header().Set("Content-Type", "text/csv")
+			if err := collector.WriteHistoryCSV(w, series); err != nil {
+				log.Errorf("error writing CSV response: %s", err.Error())
+			}
+			return
+		}
+		writeJSON(w, series)
+	})
+
+	http.HandleFunc("/api/alerts", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, rules.Alerts())
+	})
+
+	pushers, err := newPushers(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	interval := *pollInterval
+	if interval <= 0 && len(pushers) > 0 {
+		// outputs are pushed to on every poll
+		interval = time.Minute
+	}
+	if interval > 0 {
+		go poll(registry, interval, pushers)
+	}
 
 	log.Infof("Listening on %s", *listenAddress)
 	log.Fatal(http.ListenAndServe(*listenAddress, nil))
 }
 
-func handleMetricsRequest(w http.ResponseWriter, request *http.Request) {
+// poll gathers the metrics in the given interval, so the stateful parts of the collector (e.g.
+// history, outages and baselines) are updated without anybody scraping the exporter
+func poll(registry *prometheus.Registry, interval time.Duration, pushers []collector.Pusher) {
+	var outputs []chan *pollResult
+	for _, pusher := range pushers {
+		output := make(chan *pollResult, 1)
+		outputs = append(outputs, output)
+		go push(pusher, output)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		families, err := registry.Gather()
+		if err != nil {
+			log.Errorf("error polling the gateway: %s", err.Error())
+		}
+		result := &pollResult{families, now}
+		for _, output := range outputs {
+			select {
+			case output <- result:
+			default:
+				// the output is still busy, it gets the latest poll instead of the one waiting
+				select {
+				case <-output:
+					log.Warnf("output is too slow, skipping a poll")
+				default:
+				}
+				output <- result
+			}
+		}
+	}
+}
+
+type pollResult struct {
+	families []*dto.MetricFamily
+	time     time.Time
+}
+
+// push pushes the polled metrics to an output. Every output has its own, so a slow one, e.g.
+// remote write sending its buffer after an outage, doesn't hold up the polls or the other outputs.
+func push(pusher collector.Pusher, results <-chan *pollResult) {
+	for result := range results {
+		if err := pusher.Push(result.families, result.time); err != nil {
+			log.Errorf("error pushing metrics: %s", err.Error())
+		}
+	}
+}
+
+// gatherOnce polls the gateway once, without the state that is kept across polls
+func gatherOnce(cfg *config) ([]*dto.MetricFamily, error) {
+	profile, err := cfg.healthProfile(*healthProfile)
+	if err != nil {
+		return nil, err
+	}
 	registry := prometheus.NewRegistry()
 	registry.MustRegister(&collector.Collector{
-		Station: collector.NewFibertelStation(*fibertelStationUrl, *fibertelStationUsername, *fibertelStationPassword),
+		Station:         collector.NewFibertelStation(*fibertelStationUrl, *fibertelStationUsername, *fibertelStationPassword),
+		FrequencyLabels: *channelLabels == "frequency",
+		HealthProfile:   profile,
 	})
-	promhttp.HandlerFor(registry, promhttp.HandlerOpts{
-		ErrorLog:      log.NewErrorLogger(),
-		ErrorHandling: promhttp.ContinueOnError,
-	}).ServeHTTP(w, request)
+	return registry.Gather()
+}
+
+// timeParam parses an optional RFC 3339 time from the query string
+func timeParam(r *http.Request, name string, fallback time.Time) (time.Time, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return fallback, nil
+	}
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s, expected an RFC 3339 time", name)
+	}
+	return parsed, nil
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Errorf("error writing JSON response: %s", err.Error())
+	}
 }
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"github.com/reynico/fibertel-station-exporter/collector"
+	"os"
+	"time"
+)
+
+// newPushers creates the outputs of the configuration file the metrics of every poll are pushed to
+func newPushers(cfg *config) ([]collector.Pusher, error) {
+	var pushers []collector.Pusher
+	if cfg.InfluxDB != nil {
+		writer, err := collector.NewInfluxWriter(cfg.InfluxDB)
+		if err != nil {
+			return nil, err
+		}
+		pushers = append(pushers, writer)
+	}
+	if cfg.OTLP != nil {
+		exporter, err := collector.NewOTLPExporter(cfg.OTLP, *fibertelStationUrl)
+		if err != nil {
+			return nil, err
+		}
+		pushers = append(pushers, exporter)
+	}
+	if cfg.RemoteWrite != nil {
+		writer, err := collector.NewRemoteWriter(cfg.RemoteWrite)
+		if err != nil {
+			return nil, err
+		}
+		pushers = append(pushers, writer)
+	}
+	if cfg.Pushgateway != nil {
+		pusher, err := collector.NewPushgatewayPusher(cfg.Pushgateway)
+		if err != nil {
+			return nil, err
+		}
+		pushers = append(pushers, pusher)
+	}
+	if cfg.Textfile != nil {
+		writer, err := collector.NewTextfileWriter(cfg.Textfile)
+		if err != nil {
+			return nil, err
+		}
+		pushers = append(pushers, writer)
+	}
+	return pushers, nil
+}
+
+// runOnce polls the gateway once and pushes the metrics to the outputs, for cron jobs on routers
+// without a long-running exporter. It fails if the login or any output fails.
+func runOnce(cfg *config) int {
+	pushers, err := newPushers(cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 2
+	}
+	if len(pushers) == 0 {
+		fmt.Fprintln(os.Stderr, "-once needs an output in the configuration file, e.g. pushgateway or textfile")
+		return 2
+	}
+	families, err := gatherOnce(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error polling the gateway: %s\n", err.Error())
+		return 1
+	}
+	status := 0
+	if !collector.LoginSucceeded(families) {
+		fmt.Fprintln(os.Stderr, "Login to the gateway failed")
+		status = 1
+	}
+	// the metrics are pushed anyway, fibertel_login_success_bool tells about the failed login
+	now := time.Now()
+	for _, pusher := range pushers {
+		if err := pusher.Push(families, now); err != nil {
+			fmt.Fprintf(os.Stderr, "Error pushing metrics: %s\n", err.Error())
+			status = 1
+		}
+	}
+	return status
+}
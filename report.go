@@ -0,0 +1,69 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/reynico/fibertel-station-exporter/collector"
+	"io"
+	"os"
+	"time"
+)
+
+// runReport logs into the gateway once and writes a support report for the ISP
+func runReport(cfg *config, args []string) int {
+	flags := flag.NewFlagSet("report", flag.ContinueOnError)
+	format := flags.String("format", "markdown", "Report format, markdown or html")
+	period := flags.Duration("period", 24*time.Hour, "Include event log errors and outages of this period")
+	redact := flags.Bool("redact", false, "Remove the serial number, MAC and IP addresses and the gateway URL")
+	output := flags.String("output", "", "Write the report to this file instead of stdout")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *format != "markdown" && *format != "html" {
+		fmt.Fprintf(os.Stderr, "Invalid report format %q, expected markdown or html\n", *format)
+		return 2
+	}
+	profile, err := cfg.healthProfile(*healthProfile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 2
+	}
+	options := collector.ReportOptions{Period: *period, Profile: profile}
+	if *outageLogFile != "" {
+		options.Outages, err = collector.NewOutageTracker(*outageLogFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading outage log: %s\n", err.Error())
+			return 1
+		}
+	}
+
+	report, err := collector.BuildReport(collector.NewFibertelStation(*fibertelStationUrl, *fibertelStationUsername, *fibertelStationPassword), options)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error building report: %s\n", err.Error())
+		return 1
+	}
+	if *redact {
+		report.Redact()
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return 1
+		}
+		defer file.Close()
+		w = file
+	}
+	if *format == "html" {
+		err = report.WriteHTML(w)
+	} else {
+		err = report.WriteMarkdown(w)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing report: %s\n", err.Error())
+		return 1
+	}
+	return 0
+}
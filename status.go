@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/reynico/fibertel-station-exporter/collector"
+	"gopkg.in/yaml.v2"
+	"os"
+)
+
+// Exit codes of the status subcommand, following the Nagios plugin convention
+const (
+	statusExitGood     = 0
+	statusExitMarginal = 1
+	statusExitBad      = 2
+	statusExitUnknown  = 3
+)
+
+// runStatus logs into the gateway once, prints the channels and exits with the overall line health
+func runStatus(cfg *config, args []string) int {
+	flags := flag.NewFlagSet("status", flag.ContinueOnError)
+	output := flags.String("output", "table", "Output format, table, json, csv or yaml")
+	color := flags.String("color", "auto", "Colour the grades of the table, auto (when writing to a terminal), always or never")
+	if err := flags.Parse(args); err != nil {
+		return statusExitUnknown
+	}
+	switch *output {
+	case "table", "json", "csv", "yaml":
+	default:
+		fmt.Fprintf(os.Stderr, "Invalid output format %q, expected table, json, csv or yaml\n", *output)
+		return statusExitUnknown
+	}
+	var colored bool
+	switch *color {
+	case "auto":
+		colored = isTerminal(os.Stdout) && os.Getenv("NO_COLOR") == ""
+	case "always":
+		colored = true
+	case "never":
+	default:
+		fmt.Fprintf(os.Stderr, "Invalid color mode %q, expected auto, always or never\n", *color)
+		return statusExitUnknown
+	}
+	profile, err := cfg.healthProfile(*healthProfile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return statusExitUnknown
+	}
+
+	status, err := collector.FetchStatus(collector.NewFibertelStation(*fibertelStationUrl, *fibertelStationUsername, *fibertelStationPassword), profile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error getting the status: %s\n", err.Error())
+		return statusExitUnknown
+	}
+	switch *output {
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(status)
+	case "yaml":
+		err = yaml.NewEncoder(os.Stdout).Encode(status)
+	case "csv":
+		err = status.WriteCSV(os.Stdout)
+	default:
+		err = status.WriteTable(os.Stdout, colored)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing the status: %s\n", err.Error())
+		return statusExitUnknown
+	}
+
+	switch status.Health {
+	case collector.Good:
+		return statusExitGood
+	case collector.Marginal:
+		return statusExitMarginal
+	}
+	return statusExitBad
+}
+
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}